@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/v2/key"
+	"github.com/charmbracelet/bubbles/v2/textinput"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	// errNoToken is returned when no Replicate API token is configured
+	errNoToken = errors.New("replicate API token not provided")
+	// errBadToken is returned when Replicate rejects the API token
+	errBadToken = errors.New("replicate API token is invalid")
+)
+
+// tokenHint tells the user how to set up a token
+const tokenHint = "run fluxy auth login, use --api-token or set REPLICATE_API_TOKEN"
+
+// account is the Replicate account an API token belongs to
+type account struct {
+	Type     string `json:"type"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+// credentialsPath returns the file fluxy auth login stores the token in
+func credentialsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "credentials"), nil
+}
+
+// replicateToken returns the Replicate API token
+func replicateToken(c *config) (string, error) {
+	token, _, err := findToken(c)
+	return token, err
+}
+
+// findToken returns the Replicate API token and where it came from, looking
+// at the flag, the environment, the credential command and the credentials
+// file in that order
+func findToken(c *config) (string, string, error) {
+	if c.ApiToken != "" {
+		return c.ApiToken, "--api-token", nil
+	}
+	for _, env := range []string{"REPLICATE_API_TOKEN", "REPLICATE_API_KEY"} {
+		if token := os.Getenv(env); token != "" {
+			return token, env, nil
+		}
+	}
+	if c.CredentialCommand != "" {
+		token, err := runCredentialCommand(c.CredentialCommand)
+		if err != nil {
+			return "", "", err
+		}
+		return token, "credential_command", nil
+	}
+	path, err := credentialsPath()
+	if err != nil {
+		return "", "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", fmt.Errorf("%w: %s", errNoToken, tokenHint)
+	} else if err != nil {
+		return "", "", fmt.Errorf("failed to read credentials: %w", err)
+	}
+	if token := strings.TrimSpace(string(data)); token != "" {
+		return token, path, nil
+	}
+	return "", "", fmt.Errorf("%w: %s is empty, %s", errNoToken, path, tokenHint)
+}
+
+// commandTokens caches the output of credential commands, they can be slow or ask for a passphrase
+var commandTokens sync.Map
+
+// runCredentialCommand runs the command with the shell and returns the token it prints
+func runCredentialCommand(command string) (string, error) {
+	if token, ok := commandTokens.Load(command); ok {
+		return token.(string), nil
+	}
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// No stdin, the TUI owns the terminal, pass and gpg ask through pinentry
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("credential_command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	// Like pass, the token is the first line
+	token, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if token = strings.TrimSpace(token); token == "" {
+		return "", fmt.Errorf("%w: credential_command printed nothing", errNoToken)
+	}
+	commandTokens.Store(command, token)
+	return token, nil
+}
+
+// checkToken returns the account of the token, or errBadToken if Replicate rejects it
+func checkToken(token string) (account, error) {
+	var a account
+	err := getJSON(replicateAPI+"/account", token, &a)
+	return a, err
+}
+
+// saveToken stores the token in the credentials file, readable only by the user
+func saveToken(token string) (string, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create config folder: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("failed to save credentials: %w", err)
+	}
+	// WriteFile only sets the mode of new files
+	if err := os.Chmod(path, 0o600); err != nil {
+		return "", fmt.Errorf("failed to save credentials: %w", err)
+	}
+	return path, nil
+}
+
+// login checks the token and saves it
+func login(token string) (account, string, error) {
+	a, err := checkToken(token)
+	if err != nil {
+		return a, "", err
+	}
+	path, err := saveToken(token)
+	return a, path, err
+}
+
+// maskToken hides all but the start and end of the token
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return strings.Repeat("*", len(token))
+	}
+	return token[:3] + strings.Repeat("*", len(token)-7) + token[len(token)-4:]
+}
+
+// tokenCheckedMsg is the outcome of logging in from the error view
+type tokenCheckedMsg struct {
+	token   string
+	account account
+	path    string
+	err     error
+}
+
+// needsToken reports whether the error is about the token, so the error view asks for one
+func (m newModel) needsToken() bool {
+	return errors.Is(m.err, errNoToken) || errors.Is(m.err, errBadToken)
+}
+
+func newTokenInput() textinput.Model {
+	ti := textinput.New()
+	ti.Placeholder = "r8_..."
+	ti.EchoMode = textinput.EchoPassword
+	ti.EchoCharacter = '•'
+	ti.SetWidth(54)
+	ti.Focus()
+	return ti
+}
+
+// tokenKeys are the bindings of the token prompt
+type tokenKeys struct {
+	Login, Cancel, Quit key.Binding
+}
+
+// tokenBindings relabels the bindings used on the token prompt, keys that
+// type into the token are left to it
+func (m newModel) tokenBindings() tokenKeys {
+	k := m.keys
+	relabel := func(b key.Binding, desc string) key.Binding {
+		b.SetHelp(b.Help().Key, desc)
+		return untyped(b)
+	}
+	return tokenKeys{
+		Login:  relabel(k.Generate, "Log in"),
+		Cancel: relabel(k.Back, "Cancel"),
+		Quit:   untyped(k.Quit),
+	}
+}
+
+// updateTokenPrompt handles key presses while the error view asks for a token
+func (m newModel) updateTokenPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.checkingToken {
+		return m, nil
+	}
+	k := m.tokenBindings()
+	if key.Matches(msg, k.Cancel) {
+		m.tokenInput.SetValue("")
+		m.tokenErr = nil
+		return m.dismissError()
+	}
+	if key.Matches(msg, k.Login) {
+		token := strings.TrimSpace(m.tokenInput.Value())
+		if token == "" {
+			return m, nil
+		}
+		m.checkingToken = true
+		m.tokenErr = nil
+		return m, func() tea.Msg {
+			a, path, err := login(token)
+			return tokenCheckedMsg{token: token, account: a, path: path, err: err}
+		}
+	}
+	var cmd tea.Cmd
+	m.tokenInput, cmd = m.tokenInput.Update(msg)
+	return m, cmd
+}
+
+// tokenChecked generates the prompt again once the token is saved
+func (m newModel) tokenChecked(msg tokenCheckedMsg) (newModel, tea.Cmd) {
+	m.checkingToken = false
+	m.tokenInput.SetValue("")
+	if msg.err != nil {
+		m.tokenErr = msg.err
+		return m, nil
+	}
+	m.config.ApiToken = msg.token // a rejected token from the environment would win over the saved one
+	m.err = nil
+	m.tokenErr = nil
+	m, cmd := m.generateActive(m.prompt)
+	return m, tea.Batch(cmd, m.showToast(fmt.Sprintf("🔑 Logged in as %s, token saved to %s", msg.account.Username, msg.path)))
+}
+
+// tokenPromptView asks for a token below the error
+func (m newModel) tokenPromptView() string {
+	label := lipgloss.NewStyle().
+		Foreground(textColor).
+		Render("🔑 Paste a Replicate API token to log in and try again")
+	link := lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Render("https://replicate.com/account/api-tokens")
+
+	input := m.tokenInput.View()
+	if m.checkingToken {
+		input = "⏳ Checking token..."
+	}
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(primaryColor).
+		Padding(0, 1).
+		Width(60).
+		Render(input)
+
+	lines := []string{label, link, box}
+	if m.tokenErr != nil {
+		lines = append(lines, lipgloss.NewStyle().
+			Foreground(errorColor).
+			Width(60).
+			Render(fmt.Sprintf("⚠️ %v", m.tokenErr)))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+var authWithToken bool
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage your Replicate API token",
+	Long: `Manage your Replicate API token.
+
+fluxy looks for the token in --api-token, REPLICATE_API_TOKEN,
+REPLICATE_API_KEY, the credential_command in the config file and the
+credentials file fluxy auth login saves it to, in that order.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Check a token with Replicate and save it",
+	Long: `Check a token with Replicate and save it to the credentials file in
+the config folder, readable only by you.
+
+The token is asked for, or read from stdin with --with-token:
+
+  pass show replicate | fluxy auth login --with-token`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var token string
+		if authWithToken || !term.IsTerminal(int(os.Stdin.Fd())) {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				logger.Error("Failed to read token", "err", err)
+				os.Exit(1)
+			}
+			token = line
+		} else {
+			fmt.Fprint(os.Stderr, "Paste your Replicate API token (https://replicate.com/account/api-tokens): ")
+			data, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				logger.Error("Failed to read token", "err", err)
+				os.Exit(1)
+			}
+			token = string(data)
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			logger.Error("No token given")
+			os.Exit(1)
+		}
+
+		a, path, err := login(token)
+		if err != nil {
+			logger.Error("Failed to log in", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("Logged in to Replicate", "user", a.Username, "credentials", path)
+		for _, env := range []string{"REPLICATE_API_TOKEN", "REPLICATE_API_KEY"} {
+			if os.Getenv(env) != "" {
+				logger.Warn("The environment variable is used instead of the saved token", "env", env)
+			}
+		}
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which token is used and the account it belongs to",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			logger.Error("Invalid configuration", "err", err)
+			os.Exit(1)
+		}
+		token, source, err := findToken(c)
+		if err != nil {
+			logger.Error("Not logged in", "err", err)
+			os.Exit(1)
+		}
+		a, err := checkToken(token)
+		if err != nil {
+			logger.Error("Token was rejected", "token", maskToken(token), "source", source, "err", err)
+			os.Exit(1)
+		}
+		logger.Info("Logged in to Replicate", "user", a.Username, "token", maskToken(token), "source", source)
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the saved token",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := credentialsPath()
+		if err != nil {
+			logger.Error("Failed to find credentials", "err", err)
+			os.Exit(1)
+		}
+		if err := os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+			logger.Info("No saved token", "credentials", path)
+		} else if err != nil {
+			logger.Error("Failed to remove credentials", "err", err)
+			os.Exit(1)
+		} else {
+			logger.Info("Removed saved token", "credentials", path)
+		}
+		for _, env := range []string{"REPLICATE_API_TOKEN", "REPLICATE_API_KEY"} {
+			if os.Getenv(env) != "" {
+				logger.Warn("The environment variable is still set", "env", env)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authStatusCmd)
+	authCmd.AddCommand(authLogoutCmd)
+	authLoginCmd.Flags().BoolVar(&authWithToken, "with-token", false, "Read the token from stdin")
+}
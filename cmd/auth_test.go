@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// noToken clears the token from the environment and the credentials file
+func noToken(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("REPLICATE_API_TOKEN", "")
+	t.Setenv("REPLICATE_API_KEY", "")
+}
+
+func TestFindToken(t *testing.T) {
+	noToken(t)
+	c := &config{}
+	if _, _, err := findToken(c); !errors.Is(err, errNoToken) {
+		t.Fatalf("got %v, want errNoToken", err)
+	}
+
+	path, err := saveToken("saved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("credentials file: %v, %v", info.Mode(), err)
+	}
+
+	// Each source wins over the ones before it
+	for _, tt := range []struct {
+		set         func()
+		token, from string
+	}{
+		{func() {}, "saved", path},
+		{func() { c.CredentialCommand = "echo command; echo second line" }, "command", "credential_command"},
+		{func() { t.Setenv("REPLICATE_API_KEY", "key") }, "key", "REPLICATE_API_KEY"},
+		{func() { t.Setenv("REPLICATE_API_TOKEN", "token") }, "token", "REPLICATE_API_TOKEN"},
+		{func() { c.ApiToken = "flag" }, "flag", "--api-token"},
+	} {
+		tt.set()
+		token, from, err := findToken(c)
+		if err != nil || token != tt.token || from != tt.from {
+			t.Errorf("got %q from %q (%v), want %q from %q", token, from, err, tt.token, tt.from)
+		}
+	}
+
+	if _, err := runCredentialCommand("echo locked >&2; exit 3"); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("expected the failed command's stderr in the error, got %v", err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	srv := newFakeReplicate(t)
+	srv.Username = "blacktop"
+	noToken(t)
+
+	if _, _, err := login("wrong"); !errors.Is(err, errBadToken) {
+		t.Fatalf("got %v, want errBadToken", err)
+	}
+	if _, _, err := findToken(&config{}); !errors.Is(err, errNoToken) {
+		t.Fatal("a rejected token was saved")
+	}
+
+	a, path, err := login("test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Username != "blacktop" {
+		t.Errorf("got account %+v", a)
+	}
+	if token, from, err := findToken(&config{}); token != "test-token" || from != path || err != nil {
+		t.Errorf("got %q from %q (%v) after logging in", token, from, err)
+	}
+}
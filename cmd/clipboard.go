@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register decoders for converting outputs to PNG
+	"image/png"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/aymanbagabas/go-osc52/v2"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	_ "golang.org/x/image/webp"
+)
+
+// copiedMsg reports the result of a clipboard copy
+type copiedMsg struct {
+	what string // what was copied e.g. "image"
+	via  string // how it was copied e.g. "OSC 52"
+	err  error
+}
+
+// isRemoteSession reports whether fluxy is running over SSH, where the
+// system clipboard belongs to the wrong machine
+func isRemoteSession() bool {
+	return os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_CLIENT") != ""
+}
+
+// osc52Sequence returns the escape sequence to set the terminal clipboard to s,
+// wrapped for tmux or screen when needed
+func osc52Sequence(s string) string {
+	seq := osc52.New(s)
+	switch {
+	case os.Getenv("TMUX") != "":
+		seq = seq.Tmux()
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		seq = seq.Screen()
+	}
+	return seq.String()
+}
+
+// copyOSC52 copies data through the terminal with OSC 52
+func copyOSC52(what, data string) tea.Cmd {
+	return tea.Batch(
+		tea.Raw(osc52Sequence(data)),
+		func() tea.Msg { return copiedMsg{what: what, via: "OSC 52"} },
+	)
+}
+
+// copyTextCmd copies text to the system clipboard, falling back to OSC 52
+// for remote sessions or when no system clipboard is available
+func copyTextCmd(what, text string) tea.Cmd {
+	if isRemoteSession() || clipboard.Unsupported {
+		return copyOSC52(what, text)
+	}
+	return func() tea.Msg {
+		if err := clipboard.WriteAll(text); err != nil {
+			return copiedMsg{what: what, err: err}
+		}
+		return copiedMsg{what: what, via: "system clipboard"}
+	}
+}
+
+// copyImageCmd copies the image as a PNG to the system clipboard, falling back
+// to OSC 52 for remote sessions (support for binary data varies by terminal)
+func copyImageCmd(imageData []byte) tea.Cmd {
+	// Re-encoding a large image takes a while, so it's done off the event loop
+	return func() tea.Msg {
+		data, err := toPNG(imageData)
+		if err != nil {
+			return copiedMsg{what: "image", err: err}
+		}
+		if isRemoteSession() {
+			return copyOSC52("image", string(data))()
+		}
+		if err := writeImageToClipboard(data); err != nil {
+			return copiedMsg{what: "image", err: err}
+		}
+		return copiedMsg{what: "image", via: "system clipboard"}
+	}
+}
+
+// promptText returns the prompt and seed of a generation for sharing
+func promptText(g generation) string {
+	if g.Seed == 0 {
+		return g.Prompt
+	}
+	return fmt.Sprintf("%s\nSeed: %d", g.Prompt, g.Seed)
+}
+
+// toPNG converts the image data to PNG if it is in another format
+func toPNG(imageData []byte) ([]byte, error) {
+	img, format, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if format == "png" {
+		return imageData, nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeImageToClipboard puts PNG data on the system clipboard using the platform's clipboard tools
+func writeImageToClipboard(data []byte) error {
+	switch runtime.GOOS {
+	case "darwin", "windows":
+		// Neither osascript nor PowerShell can read an image from stdin
+		f, err := os.CreateTemp("", "fluxy-*.png")
+		if err != nil {
+			return fmt.Errorf("failed to create temp file: %w", err)
+		}
+		defer os.Remove(f.Name())
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write temp file: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write temp file: %w", err)
+		}
+		if runtime.GOOS == "darwin" {
+			script := fmt.Sprintf(`set the clipboard to (read (POSIX file %q) as «class PNGf»)`, f.Name())
+			return runClipboardCmd(nil, "osascript", "-e", script)
+		}
+		script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms; [System.Windows.Forms.Clipboard]::SetImage([System.Drawing.Image]::FromFile('%s'))`, f.Name())
+		return runClipboardCmd(nil, "powershell", "-NoProfile", "-STA", "-Command", script)
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			if _, err := exec.LookPath("wl-copy"); err == nil {
+				return runClipboardCmd(data, "wl-copy", "--type", "image/png")
+			}
+		}
+		if _, err := exec.LookPath("xclip"); err == nil {
+			return runClipboardCmd(data, "xclip", "-selection", "clipboard", "-t", "image/png", "-i")
+		}
+		return errors.New("no image clipboard tool found (install wl-clipboard or xclip)")
+	}
+}
+
+func runClipboardCmd(stdin []byte, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	// Output is not captured as xclip keeps its pipes open while it owns the selection
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the fluxy config file (~/.config/fluxy/config.yaml)
+type fileConfig struct {
+	Enhance enhanceConfig `yaml:"enhance"`
+	Styles  []stylePreset `yaml:"styles"`
+	// Keys remaps TUI key bindings, e.g. quit: [ctrl+q]
+	Keys   map[string][]string `yaml:"keys"`
+	Theme  string              `yaml:"theme"` // TUI theme, overridden by --theme
+	Themes []theme             `yaml:"themes"`
+	// CredentialCommand prints the Replicate API token, e.g. pass show replicate
+	CredentialCommand string `yaml:"credential_command"`
+	// Safety sets safety_tolerance or disable_safety_checker per model, e.g. pro: {tolerance: 2}
+	Safety map[string]safetySettings `yaml:"safety"`
+	// Loras are named LoRAs for --lora and the TUI's LoRA picker
+	Loras []loraPreset `yaml:"loras"`
+}
+
+// configDir returns the fluxy config folder, honoring XDG_CONFIG_HOME
+func configDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "fluxy"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "fluxy"), nil
+}
+
+// stateDir returns the folder fluxy keeps its history and other state in, honoring XDG_STATE_HOME
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "fluxy"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "fluxy"), nil
+}
+
+// defaultConfigPath returns the path of the config file used when --config is not set
+func defaultConfigPath() string {
+	dir, err := configDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+// loadConfigFile reads the config file at path, a missing file is not an error
+func loadConfigFile(path string) (*fileConfig, error) {
+	var fc fileConfig
+	if path == "" {
+		return &fc, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &fc, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return &fc, nil
+}
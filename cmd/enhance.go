@@ -0,0 +1,398 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/v2/key"
+	"github.com/charmbracelet/bubbles/v2/textarea"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/charmbracelet/log"
+)
+
+const (
+	defaultEnhanceModel        = "meta/meta-llama-3-8b-instruct"
+	defaultOpenAIEnhanceModel  = "gpt-4o-mini"
+	defaultOpenAIBaseURL       = "https://api.openai.com/v1"
+	defaultEnhanceSystemPrompt = `You are an expert prompt writer for the FLUX text-to-image models.
+Rewrite the user's idea into a single vivid image prompt of 40 to 80 words.
+Describe the subject, setting, composition, camera or art style, lighting and color palette in natural language.
+Keep every element the user asked for and do not add text, watermarks or signatures unless requested.
+Reply with the prompt only, without quotes, preamble or explanation.`
+)
+
+// enhanceConfig configures the text model used to enhance prompts
+type enhanceConfig struct {
+	Provider     string `yaml:"provider"`      // replicate (default) or openai for any OpenAI-compatible chat endpoint
+	Model        string `yaml:"model"`         // e.g. meta/meta-llama-3-8b-instruct or gpt-4o-mini
+	BaseURL      string `yaml:"base_url"`      // OpenAI-compatible API base URL
+	APIKeyEnv    string `yaml:"api_key_env"`   // env var holding the OpenAI-compatible API key
+	SystemPrompt string `yaml:"system_prompt"` // overrides the built-in FLUX system prompt
+}
+
+// withDefaults fills in any unset fields
+func (e enhanceConfig) withDefaults() enhanceConfig {
+	if e.Provider == "" {
+		e.Provider = "replicate"
+	}
+	if e.Model == "" {
+		if e.Provider == "openai" {
+			e.Model = defaultOpenAIEnhanceModel
+		} else {
+			e.Model = defaultEnhanceModel
+		}
+	}
+	if e.BaseURL == "" {
+		e.BaseURL = defaultOpenAIBaseURL
+	}
+	if e.APIKeyEnv == "" {
+		e.APIKeyEnv = "OPENAI_API_KEY"
+	}
+	if e.SystemPrompt == "" {
+		e.SystemPrompt = defaultEnhanceSystemPrompt
+	}
+	return e
+}
+
+// enhancedMsg is the result of enhancing a prompt
+type enhancedMsg struct {
+	original string
+	enhanced string
+	err      error
+}
+
+// enhancePrompt asks the configured text model to rewrite the prompt for FLUX
+func enhancePrompt(prompt string, c *config) tea.Cmd {
+	return func() tea.Msg {
+		e := c.Enhance.withDefaults()
+		var (
+			enhanced string
+			err      error
+		)
+		provider := e.Provider
+		if c.Backend == backendMock {
+			provider = backendMock
+		}
+		switch provider {
+		case backendMock:
+			enhanced = mockEnhance(prompt, c)
+		case "replicate":
+			enhanced, err = enhanceWithReplicate(prompt, e, c)
+		case "openai":
+			enhanced, err = enhanceWithOpenAI(prompt, e)
+		default:
+			err = fmt.Errorf("invalid enhance provider: %s (must be replicate or openai)", e.Provider)
+		}
+		if err == nil && enhanced == "" {
+			err = errors.New("text model returned an empty prompt")
+		}
+		return enhancedMsg{original: prompt, enhanced: enhanced, err: err}
+	}
+}
+
+// enhanceWithReplicate runs the prompt through a language model hosted on Replicate
+func enhanceWithReplicate(prompt string, e enhanceConfig, c *config) (string, error) {
+	token, err := replicateToken(c)
+	if err != nil {
+		return "", err
+	}
+	result, err := createPrediction(modelPredictionsURL(e.Model), token, map[string]any{
+		"prompt":        prompt,
+		"system_prompt": e.SystemPrompt,
+		"max_tokens":    512,
+		"temperature":   0.7,
+	})
+	if err != nil {
+		return "", err
+	}
+	result, err = waitForPrediction(token, result, nil)
+	if err != nil {
+		return "", err
+	}
+	if result.Status != "succeeded" {
+		return "", fmt.Errorf("prompt enhancement failed: %v", result.Error)
+	}
+	// Language models stream their output as a list of tokens
+	var b strings.Builder
+	switch out := result.Output.(type) {
+	case string:
+		b.WriteString(out)
+	case []any:
+		for _, tok := range out {
+			if s, ok := tok.(string); ok {
+				b.WriteString(s)
+			}
+		}
+	default:
+		return "", fmt.Errorf("unexpected output type: %T", result.Output)
+	}
+	return cleanEnhancedPrompt(b.String()), nil
+}
+
+// enhanceWithOpenAI runs the prompt through an OpenAI-compatible chat completions endpoint
+func enhanceWithOpenAI(prompt string, e enhanceConfig) (string, error) {
+	apiKey := os.Getenv(e.APIKeyEnv)
+
+	jsonPayload, err := json.Marshal(map[string]any{
+		"model": e.Model,
+		"messages": []map[string]string{
+			{"role": "system", "content": e.SystemPrompt},
+			{"role": "user", "content": prompt},
+		},
+		"temperature": 0.7,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling JSON: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(e.BaseURL, "/")+"/chat/completions", bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	log.Debug("Chat completion response", "body", string(body)+"\n")
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("prompt enhancement failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("error unmarshaling JSON: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", errors.New("chat completion returned no choices")
+	}
+	return cleanEnhancedPrompt(result.Choices[0].Message.Content), nil
+}
+
+// cleanEnhancedPrompt strips the whitespace and quotes models like to wrap their answers in
+func cleanEnhancedPrompt(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, "\"'`")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// startEnhancing switches to the enhancing spinner and requests an enhanced prompt
+func (m newModel) startEnhancing(prompt string) (newModel, tea.Cmd) {
+	m.prompt = prompt
+	m.inputMode = false
+	m.textInput.Blur()
+	m.enhancing = true
+	return m, tea.Batch(enhancePrompt(prompt, m.config), m.spinner.Tick)
+}
+
+// reviewEnhanced shows the original and enhanced prompts side by side
+func (m newModel) reviewEnhanced(msg enhancedMsg) (newModel, tea.Cmd) {
+	m.enhancing = false
+	if msg.err != nil {
+		m.inputMode = true
+		m.textInput.SetValue(msg.original)
+		return m, tea.Batch(m.textInput.Focus(), m.showToast(fmt.Sprintf("⚠️ Prompt enhancement failed: %v", msg.err)))
+	}
+	ta := textarea.New()
+	ta.ShowLineNumbers = false
+	ta.Prompt = ""
+	ta.CharLimit = 2000
+	ta.KeyMap.InsertNewline.SetEnabled(false) // prompts are a single paragraph
+	ta.SetValue(msg.enhanced)
+	m.enhanced = ta
+	m.resizeEnhanced()
+	m.reviewing = true
+	m.editingEnhanced = false
+	m.original = msg.original
+	return m, nil
+}
+
+// reviewKeys are the bindings of the enhanced prompt's review
+type reviewKeys struct {
+	Accept, Edit, Reject, StopEditing, Help, Quit key.Binding
+}
+
+// reviewBindings returns the bindings of the review, while editing the keys
+// that type into the prompt are left out
+func (m newModel) reviewBindings() reviewKeys {
+	k := reviewKeys{
+		Accept:      m.keys.Accept,
+		Edit:        m.keys.Edit,
+		Reject:      m.keys.Reject,
+		StopEditing: m.keys.Back,
+		Help:        m.keys.Help,
+		Quit:        m.keys.Quit,
+	}
+	k.StopEditing.SetHelp(k.StopEditing.Help().Key, "Stop editing")
+	if m.editingEnhanced {
+		k.Accept, k.Help, k.Quit = untyped(k.Accept), untyped(k.Help), untyped(k.Quit)
+	}
+	return k
+}
+
+// updateReview handles key presses while reviewing an enhanced prompt
+func (m newModel) updateReview(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	k := m.reviewBindings()
+	switch {
+	case key.Matches(msg, k.Quit):
+		return m, tea.Quit
+	case key.Matches(msg, k.Help):
+		return m.openHelp()
+	case key.Matches(msg, k.Accept):
+		return m.acceptEnhanced()
+	}
+
+	if m.editingEnhanced {
+		if key.Matches(msg, k.StopEditing) {
+			m.editingEnhanced = false
+			m.enhanced.Blur()
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.enhanced, cmd = m.enhanced.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case key.Matches(msg, k.Edit):
+		m.editingEnhanced = true
+		return m, m.enhanced.Focus()
+	case key.Matches(msg, k.Reject):
+		// Reject: go back to the original prompt without spending anything
+		m.reviewing = false
+		m.inputMode = true
+		m.textInput.SetValue(m.original)
+		m.textInput.CursorEnd()
+		return m, m.textInput.Focus()
+	}
+	return m, nil
+}
+
+// acceptEnhanced generates an image from the (possibly edited) enhanced prompt
+func (m newModel) acceptEnhanced() (tea.Model, tea.Cmd) {
+	prompt := strings.TrimSpace(m.enhanced.Value())
+	if prompt == "" {
+		return m, nil
+	}
+	m.reviewing = false
+	m.editingEnhanced = false
+	m.enhanced.Blur()
+	m.prompt = prompt
+	return m.generateActive(prompt)
+}
+
+// reviewLayout returns whether the prompts fit side by side and the width of each prompt box
+func (m newModel) reviewLayout() (sideBySide bool, boxWidth int) {
+	if m.width >= 90 {
+		return true, min(60, (m.width-8)/2)
+	}
+	return false, max(20, min(60, m.width-6))
+}
+
+// resizeEnhanced fits the enhanced prompt editor to its box
+func (m *newModel) resizeEnhanced() {
+	_, boxWidth := m.reviewLayout()
+	m.enhanced.SetWidth(boxWidth - 4)
+	m.enhanced.SetHeight(max(3, min(10, lipgloss.Height(lipgloss.NewStyle().Width(boxWidth-4).Render(m.enhanced.Value())))))
+}
+
+func (m newModel) enhancingView() string {
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Align(lipgloss.Center).
+		Render("✨ FLUXY")
+
+	spinner := lipgloss.NewStyle().
+		Foreground(accentColor).
+		Align(lipgloss.Center).
+		Render(m.spinner.View() + " Enhancing your prompt...")
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(primaryColor).
+		Padding(2).
+		Width(50).
+		Align(lipgloss.Center).
+		Render(lipgloss.JoinVertical(lipgloss.Center, title, "", spinner))
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
+
+func (m newModel) reviewView() string {
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Render("✨ Enhanced Prompt")
+
+	sideBySide, boxWidth := m.reviewLayout()
+
+	label := lipgloss.NewStyle().Bold(true).Foreground(mutedColor)
+	original := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(borderColor).
+		Padding(0, 1).
+		Width(boxWidth).
+		Render(lipgloss.JoinVertical(lipgloss.Left,
+			label.Render("Original"),
+			lipgloss.NewStyle().Width(boxWidth-4).Render(m.original),
+		))
+
+	enhancedBorder := accentColor
+	if m.editingEnhanced {
+		enhancedBorder = warningColor
+	}
+	enhanced := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(enhancedBorder).
+		Padding(0, 1).
+		Width(boxWidth).
+		Render(lipgloss.JoinVertical(lipgloss.Left,
+			label.Render("Enhanced"),
+			m.enhanced.View(),
+		))
+
+	var prompts string
+	if sideBySide {
+		prompts = lipgloss.JoinHorizontal(lipgloss.Top, original, "  ", enhanced)
+	} else {
+		prompts = lipgloss.JoinVertical(lipgloss.Left, original, enhanced)
+	}
+
+	k := m.reviewBindings()
+	hintText := m.hint(k.Accept, k.Edit, k.Reject)
+	if m.editingEnhanced {
+		hintText = m.hint(k.Accept, k.StopEditing)
+	}
+	hint := lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Render(hintText)
+
+	content := lipgloss.JoinVertical(lipgloss.Center, title, "", prompts, "", hint)
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, content)
+}
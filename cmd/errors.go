@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/v2/key"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// errorKind is what went wrong with a generation, the error view offers the actions that fit it
+type errorKind string
+
+const (
+	kindAuth       errorKind = "auth"       // missing or rejected API token
+	kindValidation errorKind = "validation" // Replicate rejected the input
+	kindRateLimit  errorKind = "rate limit"
+	kindSafety     errorKind = "safety"
+	kindNetwork    errorKind = "network" // connection problems and server errors
+	kindDecode     errorKind = "decode"  // the image was corrupt or in the wrong format
+	kindFailed     errorKind = "failed"  // the prediction failed for another reason
+)
+
+// generationError is a failed generation and the kind of failure it was
+type generationError struct {
+	Kind errorKind
+	Err  error
+}
+
+func (e *generationError) Error() string { return e.Err.Error() }
+func (e *generationError) Unwrap() error { return e.Err }
+
+// statusError is an error response from the Replicate API
+type statusError struct {
+	Code   int
+	Status string
+	Detail string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("replicate API error: %s: %s", e.Status, e.Detail)
+}
+
+// classify returns the error as a generationError, keeping the kind of ones that already are
+func classify(err error) error {
+	if err == nil || errors.As(err, new(*generationError)) {
+		return err
+	}
+	return &generationError{Kind: kindOf(err), Err: err}
+}
+
+func kindOf(err error) errorKind {
+	var status *statusError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errNoToken), errors.Is(err, errBadToken):
+		return kindAuth
+	case errors.As(err, new(*safetyError)):
+		return kindSafety
+	case errors.As(err, &status):
+		switch {
+		case status.Code == http.StatusTooManyRequests:
+			return kindRateLimit
+		case status.Code >= 500:
+			return kindNetwork
+		case status.Code == http.StatusUnprocessableEntity, status.Code == http.StatusBadRequest:
+			return kindValidation
+		}
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return kindNetwork
+	}
+	return kindFailed
+}
+
+// errorKindOf returns the kind of the TUI's error, "" when it wasn't classified
+func errorKindOf(err error) errorKind {
+	var ge *generationError
+	if errors.As(err, &ge) {
+		return ge.Kind
+	}
+	return ""
+}
+
+// errorAdvice is the title and advice the error view shows for each kind
+var errorAdvice = map[errorKind][2]string{
+	kindValidation: {"🚫 Replicate rejected the request", "Check the prompt and settings, or try another model"},
+	kindRateLimit:  {"⏳ Rate limited", "Replicate is throttling requests, wait a moment and retry"},
+	kindNetwork:    {"🌐 Network error", "Check your connection and retry, --timeout, --prediction-timeout and --retries help on slow networks"},
+	kindDecode:     {"🧩 The image couldn't be read", "The download was corrupt or in the wrong format, fluxy offers to download it again next time it starts (or run fluxy predictions get), retrying pays for a new image"},
+	kindFailed:     {"💥 Generation failed", "Retry, edit the prompt or try another model"},
+}
+
+// offersModel reports whether the error view lets you pick another model for the retry
+func offersModel(kind errorKind) bool {
+	return kind == kindValidation || kind == kindFailed || kind == ""
+}
+
+// errorKeys are the bindings of the error view
+type errorKeys struct {
+	PrevModel, NextModel, Retry, Edit, Copy, Dismiss, Help, Quit key.Binding
+}
+
+// errorBindings relabels the bindings used on the error view, the ones that don't fit the error are disabled
+func (m newModel) errorBindings() errorKeys {
+	k := m.keys
+	relabel := func(b key.Binding, desc string, enabled bool) key.Binding {
+		b.SetHelp(b.Help().Key, desc)
+		b.SetEnabled(enabled && b.Enabled())
+		return b
+	}
+	kind := errorKindOf(m.err)
+	return errorKeys{
+		PrevModel: relabel(k.PrevButton, "Previous model", offersModel(kind)),
+		NextModel: relabel(k.NextButton, "Model", offersModel(kind)),
+		Retry:     relabel(k.Generate, "Retry", m.failedPrompt() != ""),
+		Edit:      relabel(k.NewPrompt, "Edit prompt", true),
+		Copy:      relabel(k.CopyImage, "Copy details", true),
+		Dismiss:   relabel(k.Back, "Dismiss", true),
+		Help:      k.Help,
+		Quit:      k.Quit,
+	}
+}
+
+// failedPrompt returns the prompt of the job that failed, if the error is a job's
+func (m newModel) failedPrompt() string {
+	if i := m.job(m.activeJob); i >= 0 && m.jobs[i].status == jobFailed {
+		return m.jobs[i].prompt
+	}
+	return ""
+}
+
+// retryModels are the models the error view offers for the retry, the ones
+// that can run with the config (the LoRA models only run with LoRAs)
+func (m newModel) retryModels() []string {
+	var names []string
+	for _, spec := range fluxModels {
+		c := *m.config
+		c.FluxModel = spec.Name
+		if spec.Loras > 0 && len(c.Loras) == 0 || c.checkInputs() != nil {
+			continue
+		}
+		names = append(names, spec.Name)
+	}
+	return names
+}
+
+// updateError handles key presses on the error view
+func (m newModel) updateError(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	k := m.errorBindings()
+	switch {
+	case key.Matches(msg, k.Quit):
+		return m, tea.Quit
+	case key.Matches(msg, k.Help):
+		return m.openHelp()
+	case key.Matches(msg, k.PrevModel):
+		m.errModel = cycle(m.retryModels(), m.errModel, -1)
+	case key.Matches(msg, k.NextModel):
+		m.errModel = cycle(m.retryModels(), m.errModel, 1)
+	case key.Matches(msg, k.Retry):
+		prompt := m.failedPrompt()
+		if offersModel(errorKindOf(m.err)) {
+			// Later prompts keep the model too
+			c := *m.config
+			c.FluxModel = m.errModel
+			m.config = &c
+		}
+		m.err = nil
+		m.prompt = prompt
+		m.inputMode = false
+		return m.generateActive(prompt)
+	case key.Matches(msg, k.Edit):
+		prompt := cmp.Or(m.failedPrompt(), m.prompt)
+		m.err = nil
+		m, cmd := m.newPrompt()
+		m.textInput.SetValue(prompt)
+		m.textInput.CursorEnd()
+		return m, cmd
+	case key.Matches(msg, k.Copy):
+		return m, copyTextCmd("error details", m.errorDetails())
+	case key.Matches(msg, k.Dismiss):
+		return m.dismissError()
+	}
+	return m, nil
+}
+
+// dismissError goes back to the last image, or the prompt input without one
+func (m newModel) dismissError() (tea.Model, tea.Cmd) {
+	m.err = nil
+	if len(m.imageData) > 0 {
+		m.prompt = m.result.Prompt
+		m.inputMode = false
+		m.needsImageClear = true
+		m.imageRendered = false
+		return m, tea.ClearScreen
+	}
+	return m.newPrompt()
+}
+
+// cycle returns the choice step places after current, current when there are no choices
+func cycle(choices []string, current string, step int) string {
+	if len(choices) == 0 {
+		return current
+	}
+	i := slices.Index(choices, current)
+	return choices[((i+step)%len(choices)+len(choices))%len(choices)]
+}
+
+// errorDetails describes the error for a bug report
+func (m newModel) errorDetails() string {
+	lines := []string{
+		"fluxy " + buildVersion(),
+		"Time: " + time.Now().Format(time.RFC3339),
+	}
+	if kind := errorKindOf(m.err); kind != "" {
+		lines = append(lines, "Kind: "+string(kind))
+	}
+	if prompt := m.failedPrompt(); prompt != "" {
+		lines = append(lines, "Prompt: "+prompt)
+	}
+	lines = append(lines,
+		"Model: "+m.config.FluxModel,
+		"Aspect ratio: "+m.config.AspectRatio,
+	)
+	if m.config.Size != "" {
+		lines = append(lines, "Size: "+m.config.Size)
+	}
+	lines = append(lines,
+		"Format: "+m.config.OutputFormat,
+		"Error: "+m.err.Error(),
+	)
+	return strings.Join(lines, "\n")
+}
+
+// genericErrorView shows the error with advice for its kind and the actions that fit it
+func (m newModel) genericErrorView() string {
+	kind := errorKindOf(m.err)
+	title, advice := "Error", ""
+	if a, ok := errorAdvice[kind]; ok {
+		title, advice = a[0], a[1]
+	}
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Render(title),
+		"",
+		m.err.Error(),
+	}
+	if advice != "" {
+		lines = append(lines, "", lipgloss.NewStyle().Foreground(mutedColor).Render(advice))
+	}
+	box := lipgloss.NewStyle().
+		Foreground(errorColor).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(errorColor).
+		Padding(1).
+		Width(60).
+		Align(lipgloss.Center).
+		Render(strings.Join(lines, "\n"))
+
+	k := m.errorBindings()
+	content := []string{box, ""}
+	if k.Retry.Enabled() && offersModel(kind) {
+		content = append(content, lipgloss.NewStyle().
+			Foreground(accentColor).
+			Render("Retry with ◀ "+m.errModel+" ▶"), "")
+	}
+	hint := wrapHint(m.hintItems(k.Retry, k.NextModel, k.Edit, k.Copy, k.Dismiss, k.Help, k.Quit), min(m.width, 80))
+	content = append(content, lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Align(lipgloss.Center).
+		Render(strings.Join(hint, "\n")))
+	if m.toast != "" {
+		content = append(content, lipgloss.NewStyle().Foreground(successColor).Render(m.toast))
+	}
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, lipgloss.JoinVertical(lipgloss.Center, content...))
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// generate runs a prediction for the prompt and downloads the resulting image
+func generate(prompt string, c *config) (generation, error) {
+	return generateWithProgress(prompt, c, nil)
+}
+
+// generateWithProgress is generate, calling progress (if set) with the prediction
+// when it is created and every time it is polled. Its errors are generationErrors
+func generateWithProgress(prompt string, c *config, progress func(Response)) (generation, error) {
+	run := replicateGenerate
+	if c.Backend == backendMock {
+		run = mockGenerate
+	}
+	g, err := run(prompt, c, progress)
+	return g, classify(err)
+}
+
+// replicateGenerate generates the image with a prediction on Replicate
+func replicateGenerate(prompt string, c *config, progress func(Response)) (generation, error) {
+	apiKey, err := replicateToken(c)
+	if err != nil {
+		return generation{}, err
+	}
+
+	userPrompt := prompt
+	prompt, c = c.styled(prompt)
+	prompt = withTriggers(prompt, c.Loras)
+
+	spec, err := modelFor(c)
+	if err != nil {
+		return generation{}, err
+	}
+
+	input := Input{
+		Seed:          c.Seed,
+		Prompt:        prompt,
+		OutputFormat:  c.OutputFormat,
+		OutputQuality: 100,
+	}
+	if err := spec.inputs(c, &input); err != nil {
+		return generation{}, err
+	}
+	aspect := aspectOf(input.AspectRatio, input.Width, input.Height)
+
+	safety := c.safety()
+	input.SafetyTolerance = safety.Tolerance
+	input.DisableSafetyChecker = safety.DisableChecker
+
+	payload, err := withParams(input, c.Params)
+	if err != nil {
+		return generation{}, err
+	}
+
+	result, err := createPrediction(modelPredictionsURL(spec.Replicate), apiKey, payload)
+	if err != nil {
+		return generation{}, err
+	}
+
+	// Journal the prediction before polling so it can be recovered if fluxy exits before it finishes
+	if err := journalPrediction(journalEntry{
+		PredictionID: result.ID,
+		Prompt:       userPrompt,
+		Style:        styleName(c.Style),
+		Model:        spec.Name,
+		Seed:         c.Seed,
+		AspectRatio:  aspect,
+		Format:       c.OutputFormat,
+		CreatedAt:    time.Now(),
+	}); err != nil {
+		log.Warn("Failed to journal prediction", "id", result.ID, "err", err)
+	}
+
+	if progress != nil {
+		progress(result)
+	}
+
+	// Poll the API for the final result
+	result, err = waitForPrediction(apiKey, result, progress)
+	if err != nil {
+		if result.Status == "canceled" {
+			completePrediction(result.ID) // timed out, nothing to recover
+		}
+		return generation{}, err
+	}
+
+	if result.Status != "succeeded" {
+		completePrediction(result.ID) // nothing to recover
+		if isSafetyFailure(result.Error) {
+			return generation{}, &safetyError{Prompt: userPrompt, Model: c.FluxModel, Settings: safety, Reason: fmt.Sprint(result.Error)}
+		}
+		return generation{}, fmt.Errorf("image generation failed: %s", result.Error)
+	}
+
+	imageData, err := downloadOutput(result)
+	if err != nil {
+		return generation{}, err
+	}
+	g := generation{
+		Image:        imageData,
+		PredictionID: result.ID,
+		Prompt:       userPrompt,
+		Style:        styleName(c.Style),
+		Model:        spec.Name,
+		Seed:         result.seed(),
+		AspectRatio:  aspect,
+		Format:       c.OutputFormat,
+		CreatedAt:    time.Now(),
+	}
+	// Safety checkers replace what they flag with a black image, an image
+	// that's meant to be flat is kept in the error so it can still be shown
+	if spec.Tolerance.Max == 0 && !safety.DisableChecker && blankImage(imageData) {
+		completePrediction(result.ID)
+		return generation{}, &safetyError{Prompt: userPrompt, Model: c.FluxModel, Settings: safety, Reason: "the image came back blank", Blank: &g}
+	}
+	return g, nil
+}
+
+// downloadOutput fetches the image a succeeded prediction produced and checks
+// it's a whole image in the format that was asked for
+func downloadOutput(result Response) ([]byte, error) {
+	if result.DataRemoved {
+		return nil, fmt.Errorf("the output of prediction %s has been removed by Replicate", result.ID)
+	}
+
+	var outputURL string
+	if url, ok := result.Output.(string); ok {
+		outputURL = url
+	} else if urls, ok := result.Output.([]any); ok && len(urls) > 0 {
+		outputURL, _ = urls[0].(string)
+	}
+	if outputURL == "" {
+		return nil, fmt.Errorf("unexpected output type: %T", result.Output)
+	}
+
+	imageData, err := download(outputURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkImage(imageData, result.Input.OutputFormat); err != nil {
+		return nil, err
+	}
+	return imageData, nil
+}
+
+// predictionGeneration returns the generation for an image downloaded from an existing prediction
+func predictionGeneration(result Response, imageData []byte) generation {
+	return generation{
+		Image:        imageData,
+		PredictionID: result.ID,
+		Prompt:       result.Input.Prompt,
+		Model:        fluxModelName(result.Model),
+		Seed:         result.seed(),
+		AspectRatio:  aspectOf(result.Input.AspectRatio, result.Input.Width, result.Input.Height),
+		Format:       cmp.Or(result.Input.OutputFormat, "webp"),
+		CreatedAt:    result.CreatedAt,
+	}
+}
+
+// generateRequest is a request to generate an image from the API or MCP server,
+// empty fields fall back to the command line defaults
+type generateRequest struct {
+	Prompt      string `json:"prompt"`
+	Model       string `json:"model,omitempty"`
+	AspectRatio string `json:"aspect_ratio,omitempty"`
+	Size        string `json:"size,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Style       string `json:"style,omitempty"`
+	Seed        int    `json:"seed,omitempty"`
+}
+
+// forRequest returns a copy of the config with the request's overrides applied
+func (c *config) forRequest(r generateRequest) (*config, error) {
+	if strings.TrimSpace(r.Prompt) == "" {
+		return nil, fmt.Errorf("prompt is required")
+	}
+	rc := *c
+	if r.Model != "" {
+		spec, err := findModel(r.Model)
+		if err != nil {
+			return nil, err
+		}
+		rc.FluxModel = r.Model
+		// Drop the defaults the model doesn't take
+		if !slices.Contains(spec.Megapixels, rc.Megapixels) {
+			rc.Megapixels = ""
+		}
+		if spec.Multiple == 0 && len(spec.Megapixels) == 0 {
+			rc.Size = ""
+		}
+		rc.Raw = rc.Raw && spec.Raw
+		if spec.Loras == 0 && spec.LoraModel == "" {
+			rc.Loras = nil
+		}
+		if !spec.ImagePrompt {
+			rc.ImagePrompt = ""
+		}
+	}
+	if r.AspectRatio != "" {
+		rc.AspectRatio = r.AspectRatio
+		rc.Size = ""
+	}
+	if r.Size != "" {
+		rc.Size = r.Size
+	}
+	if r.Format != "" {
+		if !slices.Contains(validOutputFormats, r.Format) {
+			return nil, fmt.Errorf("invalid output format %q (must be one of: %s)", r.Format, strings.Join(validOutputFormats, ", "))
+		}
+		rc.OutputFormat = r.Format
+	}
+	if r.Style != "" {
+		style, err := findStyle(c.Styles, r.Style)
+		if err != nil {
+			return nil, err
+		}
+		rc.Style = style
+	}
+	if r.Seed != 0 {
+		rc.Seed = r.Seed
+	}
+	if err := rc.checkInputs(); err != nil {
+		return nil, err
+	}
+	return &rc, nil
+}
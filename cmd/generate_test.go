@@ -0,0 +1,728 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blacktop/fluxy/replicatetest"
+)
+
+// newFakeReplicate points fluxy at a fake Replicate API and keeps its state in a temporary folder
+func newFakeReplicate(t *testing.T) *replicatetest.Server {
+	t.Helper()
+	srv := replicatetest.NewServer()
+	srv.Token = "test-token"
+	t.Cleanup(srv.Close)
+
+	api, interval, backoff, wait := replicateAPI, pollInterval, retryBackoff, maxRetryWait
+	replicateAPI, pollInterval, retryBackoff, maxRetryWait = srv.URL+"/v1", time.Millisecond, time.Millisecond, time.Millisecond
+	t.Cleanup(func() { replicateAPI, pollInterval, retryBackoff, maxRetryWait = api, interval, backoff, wait })
+
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	return srv
+}
+
+func testConfig() *config {
+	return &config{
+		ApiToken:     "test-token",
+		FluxModel:    "pro",
+		AspectRatio:  "16:9",
+		OutputFormat: "png",
+		NameTemplate: defaultNameTemplate,
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	srv := newFakeReplicate(t)
+
+	g, err := generate("a cat", testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(g.Image, replicatetest.Image()) {
+		t.Error("image is not the prediction's output")
+	}
+	if g.Prompt != "a cat" || g.Model != "pro" || g.Seed != 42 || g.AspectRatio != "16:9" || g.Format != "png" {
+		t.Errorf("got %+v", g)
+	}
+
+	predictions := srv.Predictions()
+	if len(predictions) != 1 {
+		t.Fatalf("got %d predictions, want 1", len(predictions))
+	}
+	p := predictions[0]
+	if p.ID != g.PredictionID || p.Model != fluxProModel {
+		t.Errorf("got prediction %s of %s", p.ID, p.Model)
+	}
+	if p.Input["prompt"] != "a cat" || p.Input["aspect_ratio"] != "16:9" || p.Input["output_format"] != "png" || p.Input["safety_tolerance"] != 5.0 {
+		t.Errorf("got input %v", p.Input)
+	}
+
+	// The image hasn't been saved, so the prediction stays in the journal
+	pending, err := pendingPredictions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].PredictionID != g.PredictionID || pending[0].Prompt != "a cat" {
+		t.Errorf("got journal %+v", pending)
+	}
+}
+
+func TestGenerateModels(t *testing.T) {
+	srv := newFakeReplicate(t)
+
+	for _, tt := range []struct {
+		model, replicateModel string
+		input                 string
+		value                 any
+	}{
+		{"schnell", fluxSchnellModel, "disable_safety_checker", true},
+		{"pro", fluxProModel, "safety_tolerance", 5.0},
+		{"dev", fluxDevModel, "", nil},
+		{"pro-1.1", fluxPro11Model, "safety_tolerance", 5.0},
+	} {
+		c := testConfig()
+		c.FluxModel = tt.model
+		g, err := generate("a cat", c)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.model, err)
+		}
+		p, _ := srv.Prediction(g.PredictionID)
+		if p.Model != tt.replicateModel {
+			t.Errorf("%s: created a prediction of %s", tt.model, p.Model)
+		}
+		if tt.input != "" && p.Input[tt.input] != tt.value {
+			t.Errorf("%s: got %s=%v, want %v", tt.model, tt.input, p.Input[tt.input], tt.value)
+		}
+	}
+
+	c := testConfig()
+	c.FluxModel = "turbo"
+	if _, err := generate("a cat", c); err == nil {
+		t.Error("expected an invalid model to fail")
+	}
+}
+
+func TestGenerateStyleAndParams(t *testing.T) {
+	srv := newFakeReplicate(t)
+
+	c := testConfig()
+	c.Seed = 7
+	c.Style = &stylePreset{Name: "noir", Prefix: "Film noir still of", Suffix: "high contrast", AspectRatio: "21:9", Params: map[string]any{"guidance": 3.5}}
+	g, err := generate("a cat", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Prompt != "a cat" || g.Style != "noir" || g.AspectRatio != "21:9" {
+		t.Errorf("got %+v", g)
+	}
+	p, _ := srv.Prediction(g.PredictionID)
+	if p.Input["prompt"] != "Film noir still of a cat, high contrast" || p.Input["guidance"] != 3.5 || p.Input["seed"] != 7.0 {
+		t.Errorf("got input %v", p.Input)
+	}
+}
+
+func TestGenerateSizes(t *testing.T) {
+	srv := newFakeReplicate(t)
+
+	for _, tt := range []struct {
+		name                string
+		model, aspect, size string
+		megapixels          string
+		want                map[string]any
+		wantAspect          string
+	}{
+		{name: "custom size", model: "pro-1.1", size: "1344x768", want: map[string]any{"aspect_ratio": "custom", "width": 1344.0, "height": 768.0}, wantAspect: "7:4"},
+		{name: "rounded size", model: "pro-1.1", size: "1350x770", want: map[string]any{"aspect_ratio": "custom", "width": 1344.0, "height": 768.0}, wantAspect: "7:4"},
+		{name: "scaled down size", model: "pro-1.1", size: "2880x1620", want: map[string]any{"width": 1440.0, "height": 800.0}, wantAspect: "9:5"},
+		{name: "closest aspect", model: "dev", size: "1344x768", want: map[string]any{"aspect_ratio": "16:9", "megapixels": "1"}, wantAspect: "16:9"},
+		{name: "closest megapixels", model: "schnell", size: "500x400", want: map[string]any{"aspect_ratio": "5:4", "megapixels": "0.25"}, wantAspect: "5:4"},
+		{name: "megapixels", model: "dev", aspect: "4:3", megapixels: "0.25", want: map[string]any{"aspect_ratio": "4:3", "megapixels": "0.25"}, wantAspect: "4:3"},
+		{name: "4:3", model: "pro", aspect: "4:3", want: map[string]any{"aspect_ratio": "4:3", "width": nil}, wantAspect: "4:3"},
+	} {
+		c := testConfig()
+		c.FluxModel, c.Size, c.Megapixels = tt.model, tt.size, tt.megapixels
+		c.AspectRatio = cmp.Or(tt.aspect, c.AspectRatio)
+		g, err := generate("a cat", c)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if g.AspectRatio != tt.wantAspect {
+			t.Errorf("%s: got aspect ratio %s, want %s", tt.name, g.AspectRatio, tt.wantAspect)
+		}
+		p, _ := srv.Prediction(g.PredictionID)
+		for k, v := range tt.want {
+			if p.Input[k] != v {
+				t.Errorf("%s: got %s=%v, want %v", tt.name, k, p.Input[k], v)
+			}
+		}
+	}
+
+	// Inputs the model doesn't take are rejected before a prediction is created
+	for _, tt := range []struct{ model, aspect, size, megapixels string }{
+		{model: "pro", aspect: "16:9", size: "1344x768"},
+		{model: "pro-1.1", aspect: "21:9"},
+		{model: "pro-1.1", aspect: "1:1", megapixels: "1"},
+		{model: "dev", aspect: "1:1", megapixels: "2"},
+		{model: "dev", aspect: "7:4"},
+		{model: "dev", aspect: "1:1", size: "wide"},
+	} {
+		c := testConfig()
+		c.FluxModel, c.AspectRatio, c.Size, c.Megapixels = tt.model, tt.aspect, tt.size, tt.megapixels
+		if err := c.checkInputs(); err == nil {
+			t.Errorf("%+v: expected checkShape to fail", tt)
+		}
+		if _, err := generateWithProgress("a cat", c, nil); errorKindOf(err) != kindValidation {
+			t.Errorf("%+v: got error %v, want a validation error", tt, err)
+		}
+	}
+	if n := len(srv.Predictions()); n != 7 {
+		t.Errorf("got %d predictions, want 7", n)
+	}
+
+	// A style's aspect ratio replaces the size, requests can ask for one
+	c := testConfig()
+	c.FluxModel, c.Size = "pro-1.1", "1344x768"
+	if _, sc := (&config{Style: &stylePreset{Name: "noir", AspectRatio: "1:1"}, Size: c.Size}).styled("a cat"); sc.Size != "" {
+		t.Errorf("style kept the size %s", sc.Size)
+	}
+	if _, err := c.forRequest(generateRequest{Prompt: "a cat", Model: "pro"}); err != nil {
+		t.Errorf("the default size wasn't dropped for pro: %v", err)
+	}
+	rc, err := c.forRequest(generateRequest{Prompt: "a cat", Size: "800x600"})
+	if err != nil || rc.Size != "800x600" {
+		t.Errorf("got %+v, %v", rc, err)
+	}
+	if _, err := c.forRequest(generateRequest{Prompt: "a cat", AspectRatio: "21:9"}); err == nil {
+		t.Error("expected an aspect ratio pro-1.1 doesn't take to be rejected")
+	}
+}
+
+func TestGenerateRawAndImagePrompt(t *testing.T) {
+	srv := newFakeReplicate(t)
+
+	path := filepath.Join(t.TempDir(), "mood.png")
+	if err := os.WriteFile(path, replicatetest.Image(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := testConfig()
+	c.Raw, c.ImagePrompt, c.ImagePromptStrength = true, path, 0.3
+	g, err := generate("a cat", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := srv.Prediction(g.PredictionID)
+	uri, _ := p.Input["image_prompt"].(string)
+	if p.Input["raw"] != true || !strings.HasPrefix(uri, "data:image/png;base64,") || p.Input["image_prompt_strength"] != 0.3 {
+		t.Errorf("got raw=%v image_prompt=%.30s strength=%v", p.Input["raw"], uri, p.Input["image_prompt_strength"])
+	}
+
+	// URLs are passed on, pro-1.1 has no strength
+	c = testConfig()
+	c.FluxModel, c.AspectRatio, c.ImagePrompt, c.ImagePromptStrength = "pro-1.1", "1:1", "https://example.com/mood.jpg", 0.3
+	if g, err = generate("a cat", c); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = srv.Prediction(g.PredictionID)
+	if p.Input["image_prompt"] != "https://example.com/mood.jpg" || p.Input["image_prompt_strength"] != nil || p.Input["raw"] != nil {
+		t.Errorf("got input %v", p.Input)
+	}
+
+	notImage := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(notImage, []byte("not an image"), 0644)
+	for _, tt := range []struct {
+		name, model, imagePrompt string
+		raw                      bool
+		strength                 float64
+	}{
+		{name: "raw dev", model: "dev", raw: true},
+		{name: "raw pro-1.1", model: "pro-1.1", raw: true},
+		{name: "image prompt schnell", model: "schnell", imagePrompt: path},
+		{name: "missing file", model: "pro", imagePrompt: filepath.Join(t.TempDir(), "missing.png")},
+		{name: "not an image", model: "pro", imagePrompt: notImage},
+		{name: "strength", model: "pro", imagePrompt: path, strength: 2},
+	} {
+		c := testConfig()
+		c.FluxModel, c.AspectRatio, c.Raw, c.ImagePrompt, c.ImagePromptStrength = tt.model, "1:1", tt.raw, tt.imagePrompt, tt.strength
+		if _, err := generateWithProgress("a cat", c, nil); errorKindOf(err) != kindValidation {
+			t.Errorf("%s: got error %v, want a validation error", tt.name, err)
+		}
+	}
+	if n := len(srv.Predictions()); n != 2 {
+		t.Errorf("got %d predictions, want 2", n)
+	}
+}
+
+func TestGenerateLoras(t *testing.T) {
+	srv := newFakeReplicate(t)
+
+	library, err := loraLibrary([]loraPreset{
+		{Name: "brand", Weights: "acme/brand-style", Scale: 0.8, Trigger: "BRNDSTYLE"},
+		{Name: "grain", Weights: "huggingface.co/alice/film-grain"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		value   string
+		weights string
+		scale   float64
+	}{
+		{"brand", "acme/brand-style", 0.8},
+		{"brand:0.5", "acme/brand-style", 0.5},
+		{"hf:alice/film-grain:1.2", "huggingface.co/alice/film-grain", 1.2},
+		{"https://example.com/lora.safetensors", "https://example.com/lora.safetensors", 1},
+		{"acme/brand-style:5a1b2c", "acme/brand-style:5a1b2c", 1},
+	} {
+		l, err := parseLora(tt.value, library)
+		if err != nil || l.Weights != tt.weights || l.scale() != tt.scale {
+			t.Errorf("%s: got %+v, %v", tt.value, l, err)
+		}
+	}
+	for _, value := range []string{"nope", "hf:alice/film-grain:5", "brand:-2"} {
+		if _, err := parseLora(value, library); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+	for _, user := range [][]loraPreset{
+		{{Weights: "acme/brand-style"}},
+		{{Name: "a", Weights: "acme/a"}, {Name: "a", Weights: "acme/b"}},
+		{{Name: "a", Weights: "brand"}},
+	} {
+		if _, err := loraLibrary(user); err == nil {
+			t.Errorf("%+v: expected an error", user)
+		}
+	}
+
+	// dev goes through its LoRA model, triggers go in front of the prompt
+	c := testConfig()
+	c.FluxModel = "dev"
+	c.Loras = []loraPreset{library[0], {Weights: "huggingface.co/alice/film-grain", Scale: 1.2}}
+	g, err := generate("a cat", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := srv.Prediction(g.PredictionID)
+	if p.Model != fluxDevLoraModel || g.Model != "dev-lora" || g.Prompt != "a cat" {
+		t.Errorf("got a prediction of %s, generation %+v", p.Model, g)
+	}
+	if p.Input["prompt"] != "BRNDSTYLE, a cat" || p.Input["lora_weights"] != "acme/brand-style" || p.Input["lora_scale"] != 0.8 ||
+		p.Input["extra_lora"] != "huggingface.co/alice/film-grain" || p.Input["extra_lora_scale"] != 1.2 {
+		t.Errorf("got input %v", p.Input)
+	}
+	if g, err = generate("a brndstyle poster", c); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ = srv.Prediction(g.PredictionID); p.Input["prompt"] != "a brndstyle poster" {
+		t.Errorf("trigger was inserted twice: %v", p.Input["prompt"])
+	}
+
+	for _, tt := range []struct {
+		model string
+		loras []loraPreset
+	}{
+		{"pro", library[:1]},
+		{"schnell", []loraPreset{library[0], library[1], {Weights: "acme/third"}}},
+	} {
+		c := testConfig()
+		c.FluxModel, c.Loras = tt.model, tt.loras
+		if _, err := generateWithProgress("a cat", c, nil); errorKindOf(err) != kindValidation {
+			t.Errorf("%s with %d LoRAs: got error %v, want a validation error", tt.model, len(tt.loras), err)
+		}
+	}
+	if n := len(srv.Predictions()); n != 2 {
+		t.Errorf("got %d predictions, want 2", n)
+	}
+}
+
+func TestGenerateProgress(t *testing.T) {
+	srv := newFakeReplicate(t)
+	srv.Script = func(string, map[string]any) replicatetest.Script {
+		return replicatetest.Script{Polls: 3}
+	}
+
+	var mu sync.Mutex
+	var statuses []string
+	_, err := generateWithProgress("a cat", testConfig(), func(r Response) {
+		mu.Lock()
+		defer mu.Unlock()
+		statuses = append(statuses, r.Status)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(slices.Compact(statuses), ","); got != "starting,processing,succeeded" {
+		t.Errorf("got statuses %s", got)
+	}
+}
+
+func TestGenerateFailures(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		script replicatetest.Script
+		setup  func(*replicatetest.Server)
+		want   string
+	}{
+		{name: "failed", script: replicatetest.Script{Status: "failed", Error: "NSFW content detected"}, want: "NSFW content detected"},
+		{name: "canceled", script: replicatetest.Script{Status: "canceled"}, want: "image generation failed"},
+		{name: "removed", script: replicatetest.Script{DataRemoved: true}, want: "removed by Replicate"},
+		{name: "rate limited", setup: func(s *replicatetest.Server) { s.RateLimit(10) }, want: "429"},
+		{name: "cut downloads", setup: func(s *replicatetest.Server) { s.CutDownloads(10) }, want: "error reading image data"},
+		{name: "wrong format", script: replicatetest.Script{Image: []byte("<html>sorry</html>")}, want: "not a complete png"},
+		{name: "unauthorized", setup: func(s *replicatetest.Server) { s.Token = "other" }, want: "401"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeReplicate(t)
+			srv.Script = func(string, map[string]any) replicatetest.Script { return tt.script }
+			if tt.setup != nil {
+				tt.setup(srv)
+			}
+			_, err := generate("a cat", testConfig())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateRetries(t *testing.T) {
+	srv := newFakeReplicate(t)
+	srv.RateLimit(2)
+	srv.CutDownloads(2)
+
+	g, err := generate("a cat", testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(g.Image, replicatetest.Image()) {
+		t.Error("got a different image")
+	}
+	// The first cut download is resumed, the resumed one is cut again and resumed again
+	half := fmt.Sprintf("bytes=%d-", len(replicatetest.Image())/2)
+	if got, want := srv.Downloads(), []string{"", half, half}; !slices.Equal(got, want) {
+		t.Errorf("got downloads %q, want %q", got, want)
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	png := replicatetest.Image()
+	for _, tt := range []struct {
+		name   string
+		data   []byte
+		format string
+		ok     bool
+	}{
+		{"png", png, "png", true},
+		{"truncated png", png[:len(png)-4], "png", false},
+		{"png as jpg", png, "jpg", false},
+		{"jpg", []byte("\xff\xd8\xff\xe0 ... \xff\xd9"), "jpg", true},
+		{"webp", []byte("RIFF\x04\x00\x00\x00WEBP"), "webp", true},
+		{"truncated webp", []byte("RIFF\x08\x00\x00\x00WEBP"), "webp", false},
+		{"unknown format", []byte("anything"), "", true},
+	} {
+		if err := checkImage(tt.data, tt.format); (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v", tt.name, err)
+		}
+	}
+}
+
+func TestGenerateSafety(t *testing.T) {
+	srv := newFakeReplicate(t)
+
+	// Settings from the config file are sent
+	c := testConfig().withSafety("pro", safetySettings{Tolerance: 2})
+	g, err := generate("a cat", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := srv.Prediction(g.PredictionID); p.Input["safety_tolerance"] != 2.0 {
+		t.Errorf("got safety_tolerance %v, want 2", p.Input["safety_tolerance"])
+	}
+	completePrediction(g.PredictionID) // it finished, only blocked ones are checked below
+
+	black := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.Draw(black, black.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	var blank bytes.Buffer
+	png.Encode(&blank, black)
+	for _, tt := range []struct {
+		name   string
+		script replicatetest.Script
+		reason string
+	}{
+		{"flagged", replicatetest.Script{Status: "failed", Error: "NSFW content detected. Try running it again, or try a different prompt."}, "NSFW content detected"},
+		{"ultra", replicatetest.Script{Status: "failed", Error: "Prediction failed: output flagged as sensitive (E005)"}, "E005"},
+	} {
+		srv.Script = func(string, map[string]any) replicatetest.Script { return tt.script }
+		_, err := generate("a cat", c)
+		var se *safetyError
+		if !errors.As(err, &se) {
+			t.Fatalf("%s: got error %v, want a safety error", tt.name, err)
+		}
+		if se.Model != "pro" || se.Settings.Tolerance != 2 || se.Prompt != "a cat" || !strings.Contains(se.Reason, tt.reason) {
+			t.Errorf("%s: got %+v", tt.name, se)
+		}
+	}
+
+	// A blank image is only the checker's block when the model has one that's on,
+	// and it's kept in case it was meant to be flat
+	srv.Script = func(string, map[string]any) replicatetest.Script { return replicatetest.Script{Image: blank.Bytes()} }
+	for _, model := range []string{"pro", "schnell"} {
+		mc := *c
+		mc.FluxModel = model
+		g, err := generate("a black square", &mc)
+		if err != nil || !bytes.Equal(g.Image, blank.Bytes()) {
+			t.Errorf("%s: got error %v for a blank image", model, err)
+		}
+		completePrediction(g.PredictionID)
+	}
+	dev := *c
+	dev.FluxModel = "dev"
+	_, err = generate("a cat", &dev)
+	var se *safetyError
+	if !errors.As(err, &se) || !strings.Contains(se.Reason, "blank") || se.Blank == nil || !bytes.Equal(se.Blank.Image, blank.Bytes()) {
+		t.Errorf("dev: got error %v, want a safety error keeping the image", err)
+	}
+
+	if pending, _ := pendingPredictions(); len(pending) != 0 {
+		t.Errorf("blocked predictions were left to recover: %v", pending)
+	}
+
+	// Other failures aren't the safety filter's
+	srv.Script = func(string, map[string]any) replicatetest.Script {
+		return replicatetest.Script{Status: "failed", Error: "CUDA out of memory"}
+	}
+	if _, err := generate("a cat", c); err == nil || errors.As(err, new(*safetyError)) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestGenerateErrorKinds(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		script replicatetest.Script
+		setup  func(*replicatetest.Server)
+		want   errorKind
+	}{
+		{name: "unauthorized", setup: func(s *replicatetest.Server) { s.Token = "other" }, want: kindAuth},
+		{name: "invalid", script: replicatetest.Script{Invalid: "aspect_ratio must be one of the following"}, want: kindValidation},
+		{name: "rate limited", setup: func(s *replicatetest.Server) { s.RateLimit(10) }, want: kindRateLimit},
+		{name: "safety", script: replicatetest.Script{Status: "failed", Error: "NSFW content detected"}, want: kindSafety},
+		{name: "cut downloads", setup: func(s *replicatetest.Server) { s.CutDownloads(10) }, want: kindNetwork},
+		{name: "wrong format", script: replicatetest.Script{Image: []byte("<html>sorry</html>")}, want: kindDecode},
+		{name: "failed", script: replicatetest.Script{Status: "failed", Error: "CUDA out of memory"}, want: kindFailed},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeReplicate(t)
+			srv.Script = func(string, map[string]any) replicatetest.Script { return tt.script }
+			if tt.setup != nil {
+				tt.setup(srv)
+			}
+			_, err := generateWithProgress("a cat", testConfig(), nil)
+			var ge *generationError
+			if !errors.As(err, &ge) || ge.Kind != tt.want {
+				t.Fatalf("got error %v, want a %s error", err, tt.want)
+			}
+		})
+	}
+
+	// Connection failures are network errors
+	srv := newFakeReplicate(t)
+	srv.Close()
+	_, err := generateWithProgress("a cat", testConfig(), nil)
+	if kind := errorKindOf(err); kind != kindNetwork {
+		t.Errorf("got a %q error %v, want network", kind, err)
+	}
+}
+
+func TestSafetySettings(t *testing.T) {
+	for _, tt := range []struct {
+		model string
+		s     safetySettings
+		ok    bool
+	}{
+		{"pro", safetySettings{Tolerance: 1}, true},
+		{"pro", safetySettings{Tolerance: 6}, true},
+		{"pro", safetySettings{Tolerance: 7}, false},
+		{"pro", safetySettings{}, false},
+		{"pro", safetySettings{Tolerance: 2, DisableChecker: true}, false},
+		{"dev", safetySettings{DisableChecker: true}, true},
+		{"schnell", safetySettings{}, true},
+		{"schnell", safetySettings{Tolerance: 2}, false},
+		{"turbo", safetySettings{}, false},
+	} {
+		if err := tt.s.validate(tt.model); (err == nil) != tt.ok {
+			t.Errorf("%s %+v: got error %v", tt.model, tt.s, err)
+		}
+	}
+
+	settings, err := safetyLibrary(map[string]safetySettings{"dev": {DisableChecker: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings["dev"] != (safetySettings{DisableChecker: true}) || settings["pro"] != defaultSafety["pro"] {
+		t.Errorf("got %+v", settings)
+	}
+
+	if got := (safetySettings{Tolerance: 6}).relaxed("pro", 1); got.Tolerance != 6 {
+		t.Errorf("relaxed past the maximum: %+v", got)
+	}
+	if got := (safetySettings{}).relaxed("dev", 1); !got.DisableChecker {
+		t.Errorf("relaxing dev didn't disable its checker: %+v", got)
+	}
+}
+
+func TestGenerateFailedLeavesNothingToRecover(t *testing.T) {
+	srv := newFakeReplicate(t)
+	srv.Script = func(string, map[string]any) replicatetest.Script {
+		return replicatetest.Script{Status: "failed", Error: "boom"}
+	}
+	if _, err := generate("a cat", testConfig()); err == nil {
+		t.Fatal("expected the generation to fail")
+	}
+	if pending, _ := pendingPredictions(); len(pending) != 0 {
+		t.Errorf("failed prediction left in the journal: %+v", pending)
+	}
+}
+
+func TestGeneratePredictionTimeout(t *testing.T) {
+	srv := newFakeReplicate(t)
+	srv.Script = func(string, map[string]any) replicatetest.Script {
+		return replicatetest.Script{Polls: 1 << 20}
+	}
+	timeout := predictionTimeout
+	predictionTimeout = 20 * time.Millisecond
+	t.Cleanup(func() { predictionTimeout = timeout })
+
+	_, err := generate("a cat", testConfig())
+	if !errors.Is(err, errPredictionTimeout) || errorKindOf(err) != kindNetwork {
+		t.Fatalf("got error %v, want a network timeout", err)
+	}
+	if p := srv.Predictions(); len(p) != 1 || p[0].Status != "canceled" {
+		t.Errorf("expected the prediction to be canceled, got %+v", p)
+	}
+	if pending, _ := pendingPredictions(); len(pending) != 0 {
+		t.Errorf("canceled prediction left in the journal: %+v", pending)
+	}
+}
+
+func TestSaveGeneration(t *testing.T) {
+	newFakeReplicate(t)
+
+	c := testConfig()
+	c.OutputFolder = t.TempDir()
+	g, err := generate("a cat", c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := saveGeneration(g, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(path, c.OutputFolder) || !strings.HasSuffix(path, "_a_cat.png") {
+		t.Errorf("saved to %s", path)
+	}
+	if pending, _ := pendingPredictions(); len(pending) != 0 {
+		t.Errorf("saved prediction left in the journal: %+v", pending)
+	}
+	history, err := loadHistory(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].PredictionID != g.PredictionID {
+		t.Errorf("got history %+v", history)
+	}
+}
+
+func TestSaveGenerationCounter(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	c := testConfig()
+	c.OutputFolder = t.TempDir()
+	c.NameTemplate = "{{.Counter}}"
+	first := int(saveCounter.Load()) + 1
+
+	// Images saved at the same time each get their own number
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	paths := make([]string, 32)
+	for i := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			g := generation{Image: replicatetest.Image(), Prompt: "a cat", Format: "png", PredictionID: fmt.Sprint("p", i)}
+			path, err := saveGeneration(g, c)
+			if err != nil {
+				t.Error(err)
+			}
+			paths[i] = filepath.Base(path)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	slices.Sort(paths)
+	var want []string
+	for i := range paths {
+		want = append(want, fmt.Sprintf("%d.png", first+i))
+	}
+	slices.Sort(want)
+	if !slices.Equal(paths, want) {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+}
+
+func TestGetAndListPredictions(t *testing.T) {
+	srv := newFakeReplicate(t)
+	srv.PageSize = 2
+	for _, model := range []string{fluxSchnellModel, fluxProModel, fluxSchnellModel, "meta/meta-llama-3-8b-instruct", fluxSchnellModel} {
+		srv.Add(replicatetest.Prediction{Model: model, Status: "succeeded", Input: map[string]any{"prompt": model}})
+	}
+
+	all, err := listPredictions("test-token", 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].ID != "fake00000005" {
+		t.Errorf("got %d predictions starting with %s, want the 3 newest", len(all), all[0].ID)
+	}
+
+	schnell, err := listPredictions("test-token", 10, func(r Response) bool { return fluxModelName(r.Model) == "schnell" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schnell) != 3 {
+		t.Errorf("got %d schnell predictions, want 3", len(schnell))
+	}
+
+	limit := predictionsLimit
+	t.Cleanup(func() { predictionsLimit = limit })
+	for _, n := range []int{-1, 0} {
+		predictionsLimit = n
+		if err := predictionsListCmd.PreRunE(predictionsListCmd, nil); err == nil {
+			t.Errorf("expected --limit %d to fail", n)
+		}
+	}
+
+	p, err := getPrediction("test-token", "fake00000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fluxModelName(p.Model) != "pro" || p.Input.Prompt != fluxProModel {
+		t.Errorf("got %+v", p)
+	}
+	if _, err := getPrediction("test-token", "missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got error %v for a missing prediction", err)
+	}
+}
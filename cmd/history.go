@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// historyMu serializes writes to the history file within this process
+var historyMu sync.Mutex
+
+// historyEntry records an image saved by fluxy
+type historyEntry struct {
+	Path         string    `json:"path"`
+	Prompt       string    `json:"prompt"`
+	Style        string    `json:"style,omitempty"`
+	Model        string    `json:"model"`
+	Seed         int       `json:"seed,omitempty"`
+	AspectRatio  string    `json:"aspect_ratio"`
+	Format       string    `json:"format"`
+	PredictionID string    `json:"prediction_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	SavedAt      time.Time `json:"saved_at"`
+}
+
+// newHistoryEntry describes a generation saved at path
+func newHistoryEntry(g generation, path string) historyEntry {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return historyEntry{
+		Path:         path,
+		Prompt:       g.Prompt,
+		Style:        g.Style,
+		Model:        g.Model,
+		Seed:         g.Seed,
+		AspectRatio:  g.AspectRatio,
+		Format:       g.Format,
+		PredictionID: g.PredictionID,
+		CreatedAt:    g.CreatedAt,
+		SavedAt:      time.Now(),
+	}
+}
+
+// historyPath returns the path of the history file
+func historyPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// recordHistory appends a saved image to the history file
+func recordHistory(g generation, path string) error {
+	data, err := json.Marshal(newHistoryEntry(g, path))
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %w", err)
+	}
+
+	hp, err := historyPath()
+	if err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(hp), 0755); err != nil {
+		return fmt.Errorf("failed to create state folder: %w", err)
+	}
+	f, err := os.OpenFile(hp, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// loadHistory returns up to limit saved images, newest first (limit <= 0 returns all)
+func loadHistory(limit int) ([]historyEntry, error) {
+	hp, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(hp)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // skip partially written lines
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	slices.Reverse(entries)
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/v2/key"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/charmbracelet/log"
+)
+
+// journalEntry records a prediction that was created but whose image hasn't been saved yet,
+// so it can be recovered if fluxy exits before it finishes
+type journalEntry struct {
+	PredictionID string    `json:"prediction_id"`
+	Prompt       string    `json:"prompt"`
+	Style        string    `json:"style,omitempty"`
+	Model        string    `json:"model"`
+	Seed         int       `json:"seed,omitempty"`
+	AspectRatio  string    `json:"aspect_ratio"`
+	Format       string    `json:"format"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// journalDir returns the folder holding one file per pending prediction
+func journalDir() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pending"), nil
+}
+
+// journalPrediction records a created prediction, the file is written to a
+// temporary name and renamed so a crash never leaves a partial entry
+func journalPrediction(e journalEntry) error {
+	dir, err := journalDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create journal folder: %w", err)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+	path := filepath.Join(dir, e.PredictionID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	return nil
+}
+
+// completePrediction removes a prediction from the journal once there is nothing left to recover
+func completePrediction(id string) {
+	if id == "" {
+		return
+	}
+	dir, err := journalDir()
+	if err != nil {
+		return
+	}
+	if err := os.Remove(filepath.Join(dir, id+".json")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warn("Failed to update prediction journal", "id", id, "err", err)
+	}
+}
+
+// pendingPredictions returns the journaled predictions, oldest first
+func pendingPredictions() ([]journalEntry, error) {
+	dir, err := journalDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	var entries []journalEntry
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".json") {
+			continue // skip entries that were never renamed into place
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal: %w", err)
+		}
+		var e journalEntry
+		if err := json.Unmarshal(data, &e); err != nil || e.PredictionID == "" {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b journalEntry) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return entries, nil
+}
+
+// generation returns the generation for the recovered prediction's image
+func (e journalEntry) generation(result Response, imageData []byte) generation {
+	g := predictionGeneration(result, imageData)
+	g.Prompt = e.Prompt // the prediction's prompt has the style applied
+	g.Style = e.Style
+	g.Model = e.Model
+	g.AspectRatio = e.AspectRatio
+	g.Format = e.Format
+	return g
+}
+
+// recoverable is a journaled prediction that finished while fluxy wasn't running
+type recoverable struct {
+	entry  journalEntry
+	result Response
+}
+
+// pendingMsg lists the journaled predictions that can be recovered
+type pendingMsg []recoverable
+
+// recoveredMsg is the outcome of recovering predictions
+type recoveredMsg struct {
+	generations []generation
+	saved       int
+	err         error
+}
+
+// checkPending looks up the predictions left in the journal by an earlier run.
+// The ones that failed or whose output Replicate has removed are dropped, and
+// the ones still running are kept for next time.
+func checkPending(entries []journalEntry, c *config) tea.Cmd {
+	if len(entries) == 0 || c.Backend == backendMock {
+		return nil
+	}
+	return func() tea.Msg {
+		token, err := replicateToken(c)
+		if err != nil {
+			return nil
+		}
+		var ready pendingMsg
+		for _, e := range entries {
+			result, err := getPrediction(token, e.PredictionID)
+			if err != nil {
+				log.Debug("Failed to check journaled prediction", "id", e.PredictionID, "err", err)
+				continue
+			}
+			switch {
+			case !result.done():
+				continue
+			case result.Status == "succeeded" && !result.DataRemoved:
+				ready = append(ready, recoverable{entry: e, result: result})
+			default:
+				log.Debug("Dropping journaled prediction", "id", e.PredictionID, "status", result.Status)
+				completePrediction(e.PredictionID)
+			}
+		}
+		if len(ready) == 0 {
+			return nil
+		}
+		return ready
+	}
+}
+
+// recoverPredictions downloads the finished predictions and saves them to the output folder
+func recoverPredictions(ready []recoverable, c *config) tea.Cmd {
+	return func() tea.Msg {
+		var msg recoveredMsg
+		for _, r := range ready {
+			imageData, err := downloadOutput(r.result)
+			if err != nil {
+				msg.err = err
+				continue
+			}
+			g := r.entry.generation(r.result, imageData)
+			if _, err := saveGeneration(g, c); err != nil {
+				msg.err = err
+			} else {
+				msg.saved++
+			}
+			msg.generations = append(msg.generations, g)
+		}
+		return msg
+	}
+}
+
+// recoveryKeys are the bindings of the recovery prompt
+type recoveryKeys struct {
+	Recover, Discard, Later, Help, Quit key.Binding
+}
+
+// recoveryBindings relabels the bindings used on the recovery prompt
+func (m newModel) recoveryBindings() recoveryKeys {
+	k := m.keys
+	relabel := func(b key.Binding, desc string) key.Binding {
+		b.SetHelp(b.Help().Key, desc)
+		return b
+	}
+	return recoveryKeys{
+		Recover: relabel(k.Yes, "Recover and save"),
+		Discard: relabel(k.No, "Discard"),
+		Later:   relabel(k.Back, "Ask again later"),
+		Help:    k.Help,
+		Quit:    k.Quit,
+	}
+}
+
+// updateRecovery handles key presses while offering to recover predictions
+func (m newModel) updateRecovery(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	k := m.recoveryBindings()
+	switch {
+	case key.Matches(msg, k.Quit):
+		return m, tea.Quit
+	case key.Matches(msg, k.Help):
+		return m.openHelp()
+	case key.Matches(msg, k.Recover, m.keys.Select):
+		ready := m.recovery
+		m.recovery = nil
+		cmd := m.closeRecovery()
+		return m, tea.Batch(recoverPredictions(ready, m.config), cmd)
+	case key.Matches(msg, k.Discard):
+		for _, r := range m.recovery {
+			completePrediction(r.entry.PredictionID)
+		}
+		m.recovery = nil
+		cmd := m.closeRecovery()
+		return m, cmd
+	case key.Matches(msg, k.Later):
+		// Keep them in the journal and ask again next time
+		m.recovery = nil
+		cmd := m.closeRecovery()
+		return m, cmd
+	}
+	return m, nil
+}
+
+// closeRecovery redraws whatever was shown before the recovery prompt
+func (m *newModel) closeRecovery() tea.Cmd {
+	m.needsImageClear = true
+	m.imageRendered = false
+	if m.inputMode {
+		return tea.Batch(tea.ClearScreen, m.textInput.Focus())
+	}
+	return tea.ClearScreen
+}
+
+// addRecovered adds recovered images to the queue as finished jobs so they can be opened
+func (m newModel) addRecovered(msg recoveredMsg) (newModel, tea.Cmd) {
+	for _, g := range msg.generations {
+		m.nextJobID++
+		m.jobs = append(m.jobs, queueJob{
+			id:      m.nextJobID,
+			prompt:  g.Prompt,
+			config:  m.config,
+			status:  jobSucceeded,
+			started: true,
+			result:  g,
+		})
+	}
+	toast := m.withHint(fmt.Sprintf("♻️ Recovered %d image(s) to %s", msg.saved, cmp.Or(m.config.OutputFolder, ".")), m.keys.Queue)
+	if msg.err != nil {
+		toast += fmt.Sprintf(" ⚠️ %v", msg.err)
+	}
+	return m, m.showToast(toast)
+}
+
+func (m newModel) recoveryView() string {
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Render("♻️ Recover Images")
+
+	message := lipgloss.NewStyle().
+		Foreground(textColor).
+		Render(fmt.Sprintf("%d prediction(s) finished while fluxy wasn't running:", len(m.recovery)))
+
+	width := max(30, min(70, m.width-8))
+	rows := make([]string, 0, len(m.recovery))
+	for _, r := range m.recovery {
+		prompt := truncate(r.entry.Prompt, width-22)
+		rows = append(rows, fmt.Sprintf("  %s  %-7s %s", r.entry.CreatedAt.Local().Format("Jan 02 15:04"), r.entry.Model, prompt))
+	}
+
+	k := m.recoveryBindings()
+	hint := lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Render(m.hint(k.Recover, k.Discard, k.Later))
+
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		"",
+		message,
+		"",
+		lipgloss.NewStyle().Foreground(accentColor).Render(strings.Join(rows, "\n")),
+		"",
+		hint,
+	)
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(primaryColor).
+		Padding(1, 2).
+		Render(content)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
@@ -0,0 +1,361 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/v2/help"
+	"github.com/charmbracelet/bubbles/v2/key"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// keyMap holds the TUI key bindings, they can be remapped under keys in the config file
+type keyMap struct {
+	Quit        key.Binding
+	Help        key.Binding
+	Back        key.Binding
+	Generate    key.Binding
+	Enhance     key.Binding
+	Style       key.Binding
+	Raw         key.Binding
+	ImagePrompt key.Binding
+	Lora        key.Binding
+	Queue       key.Binding
+	NewPrompt   key.Binding
+	Execute     key.Binding
+	PrevButton  key.Binding
+	NextButton  key.Binding
+	CopyImage   key.Binding
+	CopyPrompt  key.Binding
+	Info        key.Binding
+	Zoom        key.Binding
+	ZoomIn      key.Binding
+	ZoomOut     key.Binding
+	ZoomReset   key.Binding
+	PanLeft     key.Binding
+	PanRight    key.Binding
+	PanUp       key.Binding
+	PanDown     key.Binding
+	Up          key.Binding
+	Down        key.Binding
+	Select      key.Binding
+	Accept      key.Binding
+	Edit        key.Binding
+	Reject      key.Binding
+	Yes         key.Binding
+	No          key.Binding
+}
+
+// binding creates a key binding, its help lists all of its keys
+func binding(desc string, keys ...string) key.Binding {
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(keyNames(keys), desc))
+}
+
+func defaultKeyMap() keyMap {
+	return keyMap{
+		Quit:        binding("Quit", "q", "ctrl+c"),
+		Help:        binding("Help", "?", "f1"),
+		Back:        binding("Back", "esc"),
+		Generate:    binding("Generate", "enter"),
+		Enhance:     binding("Enhance", "ctrl+e"),
+		Style:       binding("Style", "ctrl+t"),
+		Raw:         binding("Raw mode", "ctrl+r"),
+		ImagePrompt: binding("Image prompt", "ctrl+g"),
+		Lora:        binding("LoRAs", "ctrl+o"),
+		Queue:       binding("Queue", "ctrl+l"),
+		NewPrompt:   binding("New prompt", "n"),
+		Execute:     binding("Execute", "enter"),
+		PrevButton:  binding("Previous button", "shift+tab", "left", "h"),
+		NextButton:  binding("Next button", "tab", "right", "l"),
+		CopyImage:   binding("Copy image", "c"),
+		CopyPrompt:  binding("Copy prompt", "y"),
+		Info:        binding("Info", "i"),
+		Zoom:        binding("Zoom", "z"),
+		ZoomIn:      binding("Zoom in", "+", "="),
+		ZoomOut:     binding("Zoom out", "-"),
+		ZoomReset:   binding("Fit", "0"),
+		PanLeft:     binding("Pan left", "left", "h"),
+		PanRight:    binding("Pan right", "right", "l"),
+		PanUp:       binding("Pan up", "up", "k"),
+		PanDown:     binding("Pan down", "down", "j"),
+		Up:          binding("Up", "up", "k", "shift+tab"),
+		Down:        binding("Down", "down", "j", "tab"),
+		Select:      binding("Select", "enter"),
+		Accept:      binding("Accept & generate", "enter", "a"),
+		Edit:        binding("Edit", "e"),
+		Reject:      binding("Reject", "r", "esc"),
+		Yes:         binding("Yes", "y"),
+		No:          binding("No", "n"),
+	}
+}
+
+// named returns the bindings by the name they're remapped with in the config file
+func (k *keyMap) named() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"quit":         &k.Quit,
+		"help":         &k.Help,
+		"back":         &k.Back,
+		"generate":     &k.Generate,
+		"enhance":      &k.Enhance,
+		"style":        &k.Style,
+		"raw":          &k.Raw,
+		"image_prompt": &k.ImagePrompt,
+		"lora":         &k.Lora,
+		"queue":        &k.Queue,
+		"new_prompt":   &k.NewPrompt,
+		"execute":      &k.Execute,
+		"prev_button":  &k.PrevButton,
+		"next_button":  &k.NextButton,
+		"copy_image":   &k.CopyImage,
+		"copy_prompt":  &k.CopyPrompt,
+		"info":         &k.Info,
+		"zoom":         &k.Zoom,
+		"zoom_in":      &k.ZoomIn,
+		"zoom_out":     &k.ZoomOut,
+		"zoom_reset":   &k.ZoomReset,
+		"pan_left":     &k.PanLeft,
+		"pan_right":    &k.PanRight,
+		"pan_up":       &k.PanUp,
+		"pan_down":     &k.PanDown,
+		"up":           &k.Up,
+		"down":         &k.Down,
+		"select":       &k.Select,
+		"accept":       &k.Accept,
+		"edit":         &k.Edit,
+		"reject":       &k.Reject,
+		"yes":          &k.Yes,
+		"no":           &k.No,
+	}
+}
+
+// newKeyMap returns the default key map with the bindings remapped in the
+// config file, a binding remapped to no keys is disabled
+func newKeyMap(remap map[string][]string) (*keyMap, error) {
+	k := defaultKeyMap()
+	bindings := k.named()
+	for name, keys := range remap {
+		b, ok := bindings[name]
+		if !ok {
+			names := make([]string, 0, len(bindings))
+			for n := range bindings {
+				names = append(names, n)
+			}
+			slices.Sort(names)
+			return nil, fmt.Errorf("invalid key binding %q (must be one of: %s)", name, strings.Join(names, ", "))
+		}
+		b.SetKeys(keys...)
+		b.SetHelp(keyNames(keys), b.Help().Desc)
+	}
+	return &k, nil
+}
+
+// keyName returns how a key is shown in hints, e.g. Ctrl+E or ←
+func keyName(k string) string {
+	switch k {
+	case "left":
+		return "←"
+	case "right":
+		return "→"
+	case "up":
+		return "↑"
+	case "down":
+		return "↓"
+	}
+	if utf8.RuneCountInString(k) == 1 {
+		return strings.ToUpper(k) // could be +
+	}
+	parts := strings.Split(k, "+")
+	for i, p := range parts {
+		r, size := utf8.DecodeRuneInString(p)
+		parts[i] = strings.ToUpper(string(r)) + p[size:]
+	}
+	return strings.Join(parts, "+")
+}
+
+func keyNames(keys []string) string {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = keyName(k)
+	}
+	return strings.Join(names, "/")
+}
+
+// typed reports whether the key would type a character into a text input
+func typed(k string) bool {
+	return utf8.RuneCountInString(k) == 1 || k == "space"
+}
+
+// untyped returns the binding without the keys that type into the prompt
+func untyped(b key.Binding) key.Binding {
+	var keys []string
+	for _, k := range b.Keys() {
+		if !typed(k) {
+			keys = append(keys, k)
+		}
+	}
+	b.SetKeys(keys...)
+	b.SetHelp(keyNames(keys), b.Help().Desc)
+	return b
+}
+
+// matches reports whether the key press triggers one of the bindings. While
+// typing a prompt, keys that type a character go to the prompt instead
+func (m newModel) matches(msg tea.KeyMsg, bindings ...key.Binding) bool {
+	if m.typing() && msg.Key().Text != "" {
+		return false
+	}
+	return key.Matches(msg, bindings...)
+}
+
+// typing reports whether key presses go to the prompt input
+func (m newModel) typing() bool {
+	return m.inputMode && !m.showingHelp && !m.viewingQueue && !m.pickingStyle && !m.pickingLora
+}
+
+// hint renders the bindings as "Key: Description • …"
+func (m newModel) hint(bindings ...key.Binding) string {
+	return strings.Join(m.hintItems(bindings...), " • ")
+}
+
+// withHint adds the hint for the bindings to a toast, unless none of them
+// are bound
+func (m newModel) withHint(text string, bindings ...key.Binding) string {
+	if hint := m.hint(bindings...); hint != "" {
+		return text + " (" + hint + ")"
+	}
+	return text
+}
+
+// hintItems returns "Key: Description" for each enabled binding using the
+// first of its keys that works on the current screen
+func (m newModel) hintItems(bindings ...key.Binding) []string {
+	var items []string
+	for _, b := range bindings {
+		if !b.Enabled() {
+			continue
+		}
+		for _, k := range b.Keys() {
+			if m.typing() && typed(k) {
+				continue
+			}
+			items = append(items, keyName(k)+": "+b.Help().Desc)
+			break
+		}
+	}
+	return items
+}
+
+// helpScreen returns the name of the current screen and its bindings, grouped in columns
+func (m newModel) helpScreen() (string, [][]key.Binding) {
+	k := m.keys
+	switch {
+	case m.err != nil && errors.As(m.err, new(*safetyError)):
+		k := m.safetyBindings()
+		return "Safety filter", [][]key.Binding{{k.Stricter, k.Permissive, k.Retry, k.Edit, k.Show}, {k.Help, k.Quit}}
+	case m.err != nil && !m.needsToken():
+		e := m.errorBindings()
+		return "Error", [][]key.Binding{{e.Retry, e.PrevModel, e.NextModel, e.Edit}, {e.Copy, e.Dismiss, e.Help, e.Quit}}
+	case m.err != nil:
+		t := m.tokenBindings()
+		return "Error", [][]key.Binding{{t.Login, t.Cancel}, {k.Help, t.Quit}}
+	case len(m.recovery) > 0:
+		r := m.recoveryBindings()
+		return "Recover images", [][]key.Binding{{r.Recover, r.Discard, r.Later}, {r.Help, r.Quit}}
+	case m.saving:
+		s := m.saveBindings()
+		return "Save", [][]key.Binding{{s.PrevField, s.NextField, s.Save, s.Cancel}, {s.Overwrite, s.Keep}, {s.Help, s.Quit}}
+	case m.reviewing && m.editingEnhanced:
+		r := m.reviewBindings()
+		return "Edit enhanced prompt", [][]key.Binding{{r.Accept, r.StopEditing}, {r.Help, r.Quit}}
+	case m.reviewing:
+		r := m.reviewBindings()
+		return "Enhanced prompt", [][]key.Binding{{r.Accept, r.Edit, r.Reject}, {r.Help, r.Quit}}
+	case m.inputMode:
+		return "Prompt", [][]key.Binding{
+			{untyped(k.Generate), untyped(k.Enhance), untyped(k.Style), untyped(k.Raw), untyped(k.ImagePrompt), untyped(k.Lora), untyped(k.Queue)},
+			{untyped(k.Help), untyped(k.Quit)},
+		}
+	case m.zooming:
+		return "Zoom", [][]key.Binding{
+			{k.ZoomIn, k.ZoomOut, k.ZoomReset},
+			{k.PanLeft, k.PanRight, k.PanUp, k.PanDown},
+			{k.Back, k.Help, k.Quit},
+		}
+	case m.generating || m.enhancing:
+		return "Generating", [][]key.Binding{{k.NewPrompt, k.Queue}, {k.Help, k.Quit}}
+	default:
+		return "Result", [][]key.Binding{
+			{k.Execute, k.PrevButton, k.NextButton, k.CopyImage, k.CopyPrompt, k.Info, k.Zoom},
+			{k.NewPrompt, k.Queue, k.Help, k.Quit},
+		}
+	}
+}
+
+// openHelp shows the key bindings of the current screen
+func (m newModel) openHelp() (newModel, tea.Cmd) {
+	clearImages() // Images are drawn outside of the UI, so remove it before showing the help
+	m.showingHelp = true
+	m.textInput.Blur()
+	return m, tea.ClearScreen
+}
+
+// closeHelp goes back to the screen the help was opened on
+func (m newModel) closeHelp() (newModel, tea.Cmd) {
+	m.showingHelp = false
+	m.needsImageClear = true
+	m.imageRendered = false
+	if m.inputMode {
+		return m, tea.Batch(tea.ClearScreen, m.textInput.Focus())
+	}
+	return m, tea.ClearScreen
+}
+
+// updateHelp handles key presses while the help is shown
+func (m newModel) updateHelp(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Help, m.keys.Back):
+		return m.closeHelp()
+	case key.Matches(msg, m.keys.Quit):
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m newModel) helpView() string {
+	screen, groups := m.helpScreen()
+
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Render("🔑 Keys • " + screen)
+
+	h := help.New()
+	h.Styles.FullKey = lipgloss.NewStyle().Foreground(accentColor)
+	h.Styles.FullDesc = lipgloss.NewStyle().Foreground(textColor)
+	h.Styles.FullSeparator = lipgloss.NewStyle().Foreground(mutedColor)
+	h.FullSeparator = "    "
+
+	hint := lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Render(m.hint(m.keys.Back, m.keys.Quit))
+
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		"",
+		h.FullHelpView(groups),
+		"",
+		hint,
+	)
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(primaryColor).
+		Padding(1, 2).
+		Render(content)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
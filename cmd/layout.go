@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/blacktop/go-termimg"
+	"github.com/charmbracelet/bubbles/v2/key"
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	regenerateLabel = " 🔄 Regenerate "
+	downloadLabel   = " 💾 Download "
+	sidebarWidth    = 32
+	sidebarMinWidth = 100 // narrower terminals collapse the info sidebar
+	narrowWidth     = 40  // narrower terminals stack the buttons
+	maxHintLines    = 3
+)
+
+// rect is an area of the screen in cells, X and Y start at 0 like mouse events
+type rect struct {
+	X, Y, W, H int
+}
+
+func (r rect) contains(x, y int) bool {
+	return x >= r.X && x < r.X+r.W && y >= r.Y && y < r.Y+r.H
+}
+
+// imageLayout is where each part of the image view is drawn, it's used both
+// to render the view and to find what a mouse click hit
+type imageLayout struct {
+	Title   rect
+	Image   rect // area the image is scaled to fit in
+	Sidebar rect // info sidebar, empty when collapsed
+	Buttons [controlButtons]rect
+	Hint    rect
+	Toast   rect
+	hint    []string // hint lines wrapped to the width
+}
+
+// layout lays out the image view for the terminal size. From the top: the
+// title bar, the image with the info sidebar on its right, the buttons, the
+// key hints and the toast. The zoom viewer has no buttons and shows the
+// minimap in place of the sidebar
+func (m newModel) layout() imageLayout {
+	l := imageLayout{Title: rect{0, 0, m.width, 1}}
+
+	inner := max(1, m.width-4)
+	l.Toast = rect{2, m.height - 1, inner, 1}
+	l.hint = wrapHint(m.hintItems(m.resultBindings()...), inner)
+	l.Hint = rect{2, l.Toast.Y - len(l.hint), inner, len(l.hint)}
+
+	bottom := l.Hint.Y - 1
+	if !m.zooming {
+		regenW, downloadW := lipgloss.Width(regenerateLabel), lipgloss.Width(downloadLabel)
+		y := l.Hint.Y - 2
+		if m.width >= narrowWidth {
+			l.Buttons[0] = rect{2, y, regenW, 1}
+			l.Buttons[1] = rect{2 + regenW + 4, y, downloadW, 1}
+		} else {
+			l.Buttons[0] = rect{2, y - 1, regenW, 1}
+			l.Buttons[1] = rect{2, y, downloadW, 1}
+		}
+		bottom = l.Buttons[0].Y - 1
+	}
+
+	top := l.Title.Y + 2
+	height := max(0, bottom-top)
+	right := m.width
+	switch {
+	case m.zooming && m.width >= minimapMin:
+		l.Sidebar = rect{m.width - minimapWidth - 3, top, minimapWidth + 2, height}
+		right = l.Sidebar.X
+	case !m.zooming && m.showInfo && m.width >= sidebarMinWidth:
+		l.Sidebar = rect{m.width - sidebarWidth - 1, top, sidebarWidth, height}
+		right = l.Sidebar.X
+	}
+	l.Image = rect{2, top, max(0, right-4), height}
+	return l
+}
+
+// resultBindings are the bindings hinted below the image
+func (m newModel) resultBindings() []key.Binding {
+	k := m.keys
+	if m.zooming {
+		return []key.Binding{k.ZoomIn, k.ZoomOut, k.ZoomReset, k.PanLeft, k.PanRight, k.PanUp, k.PanDown, k.Back, k.Help, k.Quit}
+	}
+	return []key.Binding{k.Execute, k.NextButton, k.Help, k.CopyImage, k.CopyPrompt, k.Info, k.Zoom, k.NewPrompt, k.Queue, k.Quit}
+}
+
+// wrapHint joins the hint items into lines that fit the width, keeping the last lines that don't fit out
+func wrapHint(items []string, width int) []string {
+	var lines []string
+	line := ""
+	for _, item := range items {
+		switch {
+		case line == "":
+			line = item
+		case lipgloss.Width(line+" • "+item) <= width:
+			line += " • " + item
+		default:
+			lines = append(lines, line)
+			line = item
+		}
+	}
+	lines = append(lines, line)
+	if len(lines) > maxHintLines {
+		lines = lines[:maxHintLines]
+	}
+	for i, l := range lines {
+		lines[i] = ansi.Truncate(l, width, "…")
+	}
+	return lines
+}
+
+// truncate shortens the text to fit the display width, wide characters like
+// CJK or emoji take two cells
+func truncate(text string, width int) string {
+	return ansi.Truncate(text, max(0, width), "…")
+}
+
+// canvas collects what's drawn on each row, every row is turned into a line
+// of text so the view works with the cell based renderer
+type canvas struct {
+	width int
+	rows  [][]segment
+}
+
+type segment struct {
+	x, w int
+	s    string
+}
+
+func newCanvas(width, height int) *canvas {
+	return &canvas{width: width, rows: make([][]segment, max(0, height))}
+}
+
+// draw puts the text at the cell, w is how many cells it covers
+func (c *canvas) draw(x, y, w int, s string) {
+	if y >= 0 && y < len(c.rows) {
+		c.rows[y] = append(c.rows[y], segment{x, w, s})
+	}
+}
+
+// drawLines draws the lines in the area, one per row
+func (c *canvas) drawLines(r rect, lines []string) {
+	for i, line := range lines {
+		if i >= r.H {
+			break
+		}
+		c.draw(r.X, r.Y+i, ansi.StringWidth(line), line)
+	}
+}
+
+func (c *canvas) String() string {
+	lines := make([]string, len(c.rows))
+	for y, row := range c.rows {
+		slices.SortStableFunc(row, func(a, b segment) int { return a.x - b.x })
+		var b strings.Builder
+		x := 0
+		for _, seg := range row {
+			if seg.x < x {
+				continue // overlaps what's already drawn
+			}
+			b.WriteString(strings.Repeat(" ", seg.x-x))
+			b.WriteString(seg.s)
+			x = seg.x + seg.w
+		}
+		lines[y] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// imageView draws the image and its controls where the layout puts them
+func (m newModel) imageView() string {
+	l := m.layout()
+	c := newCanvas(m.width, m.height)
+
+	if m.needsImageClear {
+		clearImages()
+	}
+
+	title := "✨ " + m.prompt
+	if m.zooming {
+		title = fmt.Sprintf("🔍 %.1fx • %s", m.zoom.level, m.prompt)
+	}
+	title = ansi.Truncate(title, max(0, l.Title.W-2), "…")
+	c.draw(l.Title.X, l.Title.Y, l.Title.W, lipgloss.NewStyle().
+		Foreground(titleColor).
+		Background(primaryColor).
+		Render(centered(title, l.Title.W)))
+
+	if m.imageData != nil && l.Image.W > 0 && l.Image.H > 0 {
+		var seq string
+		var w, h int
+		var err error
+		if m.zooming {
+			seq, w, h, err = renderDecoded(crop(m.zoom.img, m.zoom.viewport()), l.Image.W, l.Image.H)
+		} else {
+			seq, w, h, err = renderImage(m.imageData, l.Image.W, l.Image.H)
+		}
+		if err != nil {
+			c.drawLines(l.Image, m.renderErrorMessage(l.Image, err.Error()))
+		} else {
+			at := rect{l.Image.X + (l.Image.W-w)/2, l.Image.Y + (l.Image.H-h)/2, w, h}
+			if lines := strings.Split(strings.TrimSuffix(seq, "\n"), "\n"); len(lines) > 1 {
+				c.drawLines(at, lines) // drawn with characters
+			} else {
+				// Drawn by the terminal's graphics protocol over the cells
+				c.draw(at.X, at.Y, 0, "\033[s"+seq+"\033[u")
+			}
+		}
+	}
+
+	switch {
+	case l.Sidebar.W == 0:
+	case m.zooming:
+		c.drawLines(l.Sidebar, m.minimapView(l.Sidebar))
+	default:
+		c.drawLines(l.Sidebar, m.sidebarView(l.Sidebar))
+	}
+
+	m.renderControls(c, l)
+	return c.String()
+}
+
+// renderControls draws the buttons, key hints and toast
+func (m newModel) renderControls(c *canvas, l imageLayout) {
+	labels := [controlButtons]string{regenerateLabel, downloadLabel}
+	colors := [controlButtons]color.Color{warningColor, successColor}
+	for i, r := range l.Buttons {
+		if r.W == 0 {
+			continue // no buttons in the zoom viewer
+		}
+		style := lipgloss.NewStyle().Foreground(textColor)
+		if i == m.selectedBtn {
+			style = highlight(colors[i])
+		}
+		c.draw(r.X, r.Y, r.W, style.Render(labels[i]))
+	}
+
+	hint := lipgloss.NewStyle().Foreground(mutedColor)
+	for i, line := range l.hint {
+		c.draw(l.Hint.X, l.Hint.Y+i, ansi.StringWidth(line), hint.Render(line))
+	}
+
+	if m.toast != "" {
+		toast := ansi.Truncate(m.toast, l.Toast.W, "…")
+		c.draw(l.Toast.X, l.Toast.Y, ansi.StringWidth(toast), lipgloss.NewStyle().Foreground(successColor).Render(toast))
+	}
+}
+
+// sidebarView returns the lines of the info sidebar
+func (m newModel) sidebarView(r rect) []string {
+	g := m.result
+	label := lipgloss.NewStyle().Foreground(mutedColor)
+	value := lipgloss.NewStyle().Foreground(textColor)
+
+	var rows [][2]string
+	add := func(name, v string) {
+		if v != "" {
+			rows = append(rows, [2]string{name, v})
+		}
+	}
+	add("Model", g.Model)
+	if g.Seed != 0 {
+		add("Seed", fmt.Sprint(g.Seed))
+	}
+	add("Aspect", g.AspectRatio)
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(m.imageData)); err == nil {
+		add("Size", fmt.Sprintf("%dx%d", cfg.Width, cfg.Height))
+	}
+	add("Format", g.Format)
+	add("File", fmt.Sprintf("%d KB", len(m.imageData)/1024))
+	add("Style", g.Style)
+	add("ID", g.PredictionID)
+
+	lines := []string{lipgloss.NewStyle().Bold(true).Foreground(primaryColor).Render("ℹ Info"), ""}
+	for _, row := range rows {
+		v := ansi.Truncate(row[1], r.W-9, "…")
+		lines = append(lines, label.Render(fmt.Sprintf("%-7s", row[0]))+"  "+value.Render(v))
+	}
+	return lines
+}
+
+// centered pads the text to the width with the text in the middle
+func centered(text string, width int) string {
+	left := max(0, (width-lipgloss.Width(text))/2)
+	right := max(0, width-left-lipgloss.Width(text))
+	return strings.Repeat(" ", left) + text + strings.Repeat(" ", right)
+}
+
+// buttonAt returns the button at the cell, or -1
+func (l imageLayout) buttonAt(x, y int) int {
+	for i, r := range l.Buttons {
+		if r.contains(x, y) {
+			return i
+		}
+	}
+	return -1
+}
+
+// renderErrorMessage returns the lines of an error box filling the area
+func (m newModel) renderErrorMessage(r rect, message string) []string {
+	// Add terminal info to help with debugging
+	terminalInfo := fmt.Sprintf("Terminal: %s", os.Getenv("TERM"))
+	if os.Getenv("TERM_PROGRAM") != "" {
+		terminalInfo += fmt.Sprintf(" (%s)", os.Getenv("TERM_PROGRAM"))
+	}
+
+	// Add protocol info
+	protocol := termimg.DetectProtocol()
+	protocolInfo := fmt.Sprintf("Protocol: %s", protocol.String())
+
+	errorBox := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(errorColor).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(errorColor).
+		Padding(1, 2).
+		Width(min(70, r.W)).
+		Align(lipgloss.Center).
+		Render(fmt.Sprintf("🚨 Image Error\n\n%s\n\n%s\n%s", message, terminalInfo, protocolInfo))
+
+	return strings.Split(lipgloss.Place(r.W, r.H, lipgloss.Center, lipgloss.Center, errorBox), "\n")
+}
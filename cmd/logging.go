@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/log"
+)
+
+var (
+	// logging flags
+	logFile   string
+	logLevel  string
+	httpTrace bool
+	harFile   string
+
+	validLogLevels = []string{"debug", "info", "warn", "error"}
+)
+
+// setupLogging sets the log level, sends the logs to --log-file and traces
+// HTTP requests when asked to
+func setupLogging() error {
+	level, err := log.ParseLevel(logLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q (must be one of: %s)", logLevel, strings.Join(validLogLevels, ", "))
+	}
+	if verbose {
+		level = log.DebugLevel
+	}
+	// The commands log to logger, the rest to the default logger, both go
+	// to the same place
+	loggers := []*log.Logger{log.Default(), logger}
+	for _, l := range loggers {
+		l.SetLevel(level)
+	}
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		for _, l := range loggers {
+			l.SetOutput(f)
+			l.SetFormatter(log.LogfmtFormatter)
+			l.SetReportTimestamp(true)
+		}
+	}
+	if httpTrace || harFile != "" {
+		base := httpClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		httpClient.Transport = &tracer{base: base, log: httpTrace, har: harFile}
+	}
+	return nil
+}
+
+// holdLogs keeps the logs from being printed over the TUI without a log
+// file, release prints them once it's closed
+func holdLogs() (release func()) {
+	if logFile != "" {
+		return func() {}
+	}
+	var buf lockedBuffer
+	log.SetOutput(&buf)
+	logger.SetOutput(&buf)
+	return func() {
+		log.SetOutput(os.Stderr)
+		logger.SetOutput(os.Stderr)
+		os.Stderr.Write(buf.Bytes())
+	}
+}
+
+// lockedBuffer is a buffer that's safe to log to from several goroutines
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// tracer records every request and response, logging them with --http-trace
+// and saving them to the --har file
+type tracer struct {
+	base http.RoundTripper
+	log  bool
+	har  string
+
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+func (t *tracer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	wait := time.Since(start)
+
+	entry := harEntry{
+		StartedDateTime: start,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(req.Header),
+			QueryString: []harPair{},
+			Cookies:     []harPair{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Response: harResponse{
+			HTTPVersion: "HTTP/1.1",
+			Headers:     []harPair{},
+			Cookies:     []harPair{},
+			HeadersSize: -1,
+		},
+		Timings: harTimings{Wait: millis(wait)},
+	}
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harPair{name, v})
+		}
+	}
+	if reqBody != nil {
+		entry.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: traceBody(req.Header.Get("Content-Type"), reqBody)}
+	}
+	if err != nil {
+		entry.Time = millis(wait)
+		entry.Comment = err.Error()
+		t.finish(entry, err)
+		return nil, err
+	}
+
+	entry.Response.Status = resp.StatusCode
+	entry.Response.StatusText = http.StatusText(resp.StatusCode)
+	entry.Response.HTTPVersion = resp.Proto
+	entry.Response.Headers = harHeaders(resp.Header)
+	// The response is traced once its body is read and closed, so downloads
+	// are streamed (and resumed) as usual
+	contentType := resp.Header.Get("Content-Type")
+	_, elide := elidedType(contentType)
+	resp.Body = &tracedBody{ReadCloser: resp.Body, keep: !elide, done: func(body []byte, n int, readErr error) {
+		entry.Time = millis(time.Since(start))
+		entry.Timings.Receive = entry.Time - entry.Timings.Wait
+		entry.Response.BodySize = n
+		entry.Response.Content = harContent{Size: n, MimeType: contentType}
+		if elide {
+			entry.Response.Content.Text = elided(contentType, n)
+		} else {
+			entry.Response.Content.Text = traceBody(contentType, body)
+		}
+		if readErr != nil {
+			entry.Comment = readErr.Error()
+		}
+		t.finish(entry, readErr)
+	}}
+	return resp, nil
+}
+
+// finish logs the request with --http-trace and adds it to the --har file
+func (t *tracer) finish(entry harEntry, err error) {
+	duration := time.Duration(entry.Time * float64(time.Millisecond)).Round(time.Millisecond)
+	if t.log {
+		kv := []any{"method", entry.Request.Method, "url", entry.Request.URL}
+		if entry.Response.Status != 0 {
+			kv = append(kv, "status", entry.Response.Status)
+		}
+		kv = append(kv, "duration", duration)
+		if entry.Response.Status != 0 {
+			kv = append(kv, "request", entry.Request.PostData.text(), "response", entry.Response.Content.Text)
+		}
+		if err != nil {
+			kv = append(kv, "err", err)
+		}
+		log.Info("HTTP", kv...)
+	}
+	if t.har != "" {
+		t.record(entry)
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// tracedBody counts (and, unless it's elided, keeps) a response body as it's
+// read, calling done when it's closed
+type tracedBody struct {
+	io.ReadCloser
+	keep bool
+	done func(body []byte, n int, err error)
+
+	buf  bytes.Buffer
+	n    int
+	err  error
+	once sync.Once
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += n
+	if b.keep {
+		b.buf.Write(p[:n])
+	}
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.buf.Bytes(), b.n, b.err) })
+	return err
+}
+
+// record adds the entry to the HAR file, which is rewritten every time so
+// it's complete however fluxy exits
+func (t *tracer) record(entry harEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, entry)
+	var har struct {
+		Log harLog `json:"log"`
+	}
+	har.Log = harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "fluxy", Version: buildVersion()},
+		Entries: t.entries,
+	}
+	data, err := json.MarshalIndent(har, "", "  ")
+	if err == nil {
+		err = os.WriteFile(t.har, data, 0o600)
+	}
+	if err != nil {
+		log.Warn("Failed to write HAR file", "path", t.har, "err", err)
+	}
+}
+
+// redactedHeaders are left out of traces, they hold credentials
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+func harHeaders(h http.Header) []harPair {
+	pairs := []harPair{}
+	for name, values := range h {
+		for _, v := range values {
+			for _, r := range redactedHeaders {
+				if strings.EqualFold(name, r) {
+					v = "[redacted]"
+				}
+			}
+			pairs = append(pairs, harPair{name, v})
+		}
+	}
+	return pairs
+}
+
+// dataURIRe matches images inlined into JSON bodies
+var dataURIRe = regexp.MustCompile(`data:[\w/.+-]+;base64,[A-Za-z0-9+/=]{64,}`)
+
+// elidedType returns the media type and whether bodies of it are left out of traces
+func elidedType(contentType string) (string, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType, strings.HasPrefix(mediaType, "image/") || mediaType == "application/octet-stream"
+}
+
+// elided is how a body that's left out of traces is shown
+func elided(contentType string, n int) string {
+	mediaType, _ := elidedType(contentType)
+	return fmt.Sprintf("[%d bytes of %s elided]", n, cmp.Or(mediaType, "binary data"))
+}
+
+// traceBody returns the body as it's traced, with images elided
+func traceBody(contentType string, body []byte) string {
+	if _, elide := elidedType(contentType); elide || !utf8.Valid(body) {
+		return elided(contentType, len(body))
+	}
+	return dataURIRe.ReplaceAllStringFunc(string(body), func(uri string) string {
+		prefix, _, _ := strings.Cut(uri, ",")
+		return fmt.Sprintf("%s,[%d bytes elided]", prefix, len(uri)-len(prefix)-1)
+	})
+}
+
+// HAR 1.2, see http://www.softwareishard.com/blog/har-12-spec/
+type (
+	harLog struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	}
+	harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	harEntry struct {
+		StartedDateTime time.Time   `json:"startedDateTime"`
+		Time            float64     `json:"time"` // milliseconds
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		Comment         string      `json:"comment,omitempty"` // why the request failed
+	}
+	harRequest struct {
+		Method      string       `json:"method"`
+		URL         string       `json:"url"`
+		HTTPVersion string       `json:"httpVersion"`
+		Headers     []harPair    `json:"headers"`
+		QueryString []harPair    `json:"queryString"`
+		Cookies     []harPair    `json:"cookies"`
+		PostData    *harPostData `json:"postData,omitempty"`
+		HeadersSize int          `json:"headersSize"`
+		BodySize    int          `json:"bodySize"`
+	}
+	harResponse struct {
+		Status      int        `json:"status"`
+		StatusText  string     `json:"statusText"`
+		HTTPVersion string     `json:"httpVersion"`
+		Headers     []harPair  `json:"headers"`
+		Cookies     []harPair  `json:"cookies"`
+		Content     harContent `json:"content"`
+		RedirectURL string     `json:"redirectURL"`
+		HeadersSize int        `json:"headersSize"`
+		BodySize    int        `json:"bodySize"`
+	}
+	harPair struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	harPostData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	}
+	harContent struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	}
+	harTimings struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	}
+)
+
+func (p *harPostData) text() string {
+	if p == nil {
+		return ""
+	}
+	return p.Text
+}
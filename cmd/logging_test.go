@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/fluxy/replicatetest"
+	"github.com/charmbracelet/log"
+)
+
+func TestHTTPTrace(t *testing.T) {
+	newFakeReplicate(t)
+	har := filepath.Join(t.TempDir(), "trace.har")
+	httpClient.Transport = &tracer{base: http.DefaultTransport, log: true, har: har}
+	t.Cleanup(func() { httpClient.Transport = nil })
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	if _, err := generate("a cat", testConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "test-token") || strings.Contains(logs.String(), "test-token") {
+		t.Error("the token was traced")
+	}
+	var h struct {
+		Log harLog `json:"log"`
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		t.Fatal(err)
+	}
+	entries := h.Log.Entries
+	if len(entries) < 3 {
+		t.Fatalf("got %d entries, want the create, the polls and the download", len(entries))
+	}
+
+	create := entries[0]
+	if create.Request.Method != "POST" || create.Response.Status != http.StatusCreated || !strings.Contains(create.Request.PostData.Text, `"prompt":"a cat"`) {
+		t.Errorf("got create entry %+v", create)
+	}
+	for _, header := range create.Request.Headers {
+		if header.Name == "Authorization" && header.Value != "[redacted]" {
+			t.Errorf("got Authorization %q", header.Value)
+		}
+	}
+	download := entries[len(entries)-1]
+	if !strings.HasSuffix(download.Response.Content.Text, "bytes of image/png elided]") {
+		t.Errorf("got download content %q", download.Response.Content.Text)
+	}
+	if n := strings.Count(logs.String(), "HTTP"); n != len(entries) {
+		t.Errorf("logged %d requests, recorded %d", n, len(entries))
+	}
+}
+
+func TestHTTPTraceResumesDownloads(t *testing.T) {
+	srv := newFakeReplicate(t)
+	srv.CutDownloads(1)
+	har := filepath.Join(t.TempDir(), "trace.har")
+	httpClient.Transport = &tracer{base: http.DefaultTransport, har: har}
+	t.Cleanup(func() { httpClient.Transport = nil })
+
+	g, err := generate("a cat", testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(g.Image, replicatetest.Image()) {
+		t.Error("got a different image")
+	}
+	half := fmt.Sprintf("bytes=%d-", len(replicatetest.Image())/2)
+	if got, want := srv.Downloads(), []string{"", half}; !slices.Equal(got, want) {
+		t.Errorf("got downloads %q, want %q", got, want)
+	}
+
+	data, err := os.ReadFile(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h struct {
+		Log harLog `json:"log"`
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		t.Fatal(err)
+	}
+	entries := h.Log.Entries
+	cut, resumed := entries[len(entries)-2], entries[len(entries)-1]
+	if cut.Comment == "" || cut.Response.BodySize != len(replicatetest.Image())/2 {
+		t.Errorf("got cut download entry %+v", cut)
+	}
+	if resumed.Response.Status != http.StatusPartialContent || resumed.Comment != "" {
+		t.Errorf("got resumed download entry %+v", resumed)
+	}
+}
+
+func TestTraceBody(t *testing.T) {
+	image := "data:image/png;base64," + strings.Repeat("A", 100)
+	if got := traceBody("application/json", []byte(`{"image_prompt":"`+image+`"}`)); got != `{"image_prompt":"data:image/png;base64,[100 bytes elided]"}` {
+		t.Errorf("got %s", got)
+	}
+	if got := traceBody("", []byte{0xff, 0xfe}); got != "[2 bytes of binary data elided]" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	srv := newTestServer(t, "")
+	file, level := logFile, logLevel
+	logFile, logLevel = filepath.Join(t.TempDir(), "fluxy.log"), "info"
+	t.Cleanup(func() {
+		logFile, logLevel = file, level
+		for _, l := range []*log.Logger{log.Default(), logger} {
+			l.SetOutput(os.Stderr)
+			l.SetFormatter(log.TextFormatter)
+			l.SetReportTimestamp(false)
+			l.SetLevel(log.InfoLevel)
+		}
+	})
+	if err := setupLogging(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server logs its jobs to the file
+	var j job
+	call(t, "POST", srv.URL+"/api/generate", `{"prompt":"a cat"}`, &j)
+	waitForJob(t, srv, j.ID)
+	log.Warn("Something's off")
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`msg="Generating image" job=` + j.ID, `msg="Something's off"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("log file is missing %s:\n%s", want, data)
+		}
+	}
+}
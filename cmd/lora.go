@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/v2/key"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// loraFlags are the --lora values, <name|url|hf:owner/name|owner/model>[:scale]
+var loraFlags []string
+
+// loraPreset is a LoRA from the library (loras in the config file) or --lora
+type loraPreset struct {
+	Name        string  `yaml:"name"` // empty for LoRAs given by their weights
+	Description string  `yaml:"description"`
+	Weights     string  `yaml:"weights"` // Replicate model, huggingface.co/owner/name or .safetensors URL
+	Scale       float64 `yaml:"scale"`   // how strongly it's applied (0: 1)
+	Trigger     string  `yaml:"trigger"` // trigger words inserted into prompts that don't have them
+}
+
+// label is how the LoRA is shown, its name or its weights
+func (l loraPreset) label() string {
+	return cmp.Or(l.Name, l.Weights)
+}
+
+// scale returns how strongly the LoRA is applied
+func (l loraPreset) scale() float64 {
+	return cmp.Or(l.Scale, 1)
+}
+
+// validate checks the LoRA's weights and scale
+func (l loraPreset) validate() error {
+	if !validLoraWeights(l.Weights) {
+		return fmt.Errorf("lora %s: invalid weights %q (must be a URL, a Hugging Face ID like huggingface.co/owner/name or a Replicate model like owner/name)", l.label(), l.Weights)
+	}
+	if l.Scale < -1 || l.Scale > 3 {
+		return fmt.Errorf("lora %s: invalid scale %v (must be between -1 and 3)", l.label(), l.Scale)
+	}
+	return nil
+}
+
+// validLoraWeights reports whether the weights look like something lora_weights takes
+func validLoraWeights(weights string) bool {
+	if strings.HasPrefix(weights, "https://") || strings.HasPrefix(weights, "http://") {
+		return !strings.ContainsAny(weights, " \t")
+	}
+	owner, name, ok := strings.Cut(strings.TrimPrefix(weights, "huggingface.co/"), "/")
+	return ok && owner != "" && name != "" && !strings.ContainsAny(weights, " \t")
+}
+
+// loraLibrary validates the LoRAs in the config file
+func loraLibrary(user []loraPreset) ([]loraPreset, error) {
+	for i, l := range user {
+		if l.Name == "" {
+			return nil, fmt.Errorf("lora %s is missing a name", l.Weights)
+		}
+		if slices.ContainsFunc(user[:i], func(o loraPreset) bool { return o.Name == l.Name }) {
+			return nil, fmt.Errorf("lora %s is in the config file twice", l.Name)
+		}
+		if err := l.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// parseLora parses a --lora value, a name from the library or the LoRA's
+// weights, hf:owner/name being short for huggingface.co/owner/name, with an
+// optional :scale
+func parseLora(value string, library []loraPreset) (loraPreset, error) {
+	source, scale := value, 0.0
+	if i := strings.LastIndex(value, ":"); i > 0 {
+		if s, err := strconv.ParseFloat(value[i+1:], 64); err == nil {
+			source, scale = value[:i], s
+		}
+	}
+	l := loraPreset{Weights: source}
+	if i := slices.IndexFunc(library, func(p loraPreset) bool { return p.Name == source }); i >= 0 {
+		l = library[i]
+	} else if id, ok := strings.CutPrefix(source, "hf:"); ok {
+		l.Weights = "huggingface.co/" + id
+	} else if !validLoraWeights(source) {
+		names := make([]string, 0, len(library))
+		for _, p := range library {
+			names = append(names, p.Name)
+		}
+		return l, fmt.Errorf("unknown lora %q (must be a URL, hf:owner/name, a Replicate model like owner/name or one of the library's: %s)", source, cmp.Or(strings.Join(names, ", "), "none"))
+	}
+	if scale != 0 {
+		l.Scale = scale
+	}
+	return l, l.validate()
+}
+
+// withLoras sets the LoRA inputs of the prediction, returning an error if the
+// model takes fewer LoRAs than the config has
+func (s *modelSpec) withLoras(c *config, input *Input) error {
+	switch {
+	case len(c.Loras) == 0:
+		return nil
+	case s.Loras == 0:
+		return &generationError{Kind: kindValidation, Err: fmt.Errorf("%s doesn't take LoRAs, use dev or schnell instead", s.Name)}
+	case len(c.Loras) > s.Loras:
+		return &generationError{Kind: kindValidation, Err: fmt.Errorf("%s takes at most %d LoRAs, got %d", s.Name, s.Loras, len(c.Loras))}
+	}
+	input.LoraWeights, input.LoraScale = c.Loras[0].Weights, c.Loras[0].scale()
+	if len(c.Loras) > 1 {
+		input.ExtraLora, input.ExtraLoraScale = c.Loras[1].Weights, c.Loras[1].scale()
+	}
+	return nil
+}
+
+// withTriggers puts the trigger words of the LoRAs the prompt doesn't mention
+// yet in front of it
+func withTriggers(prompt string, loras []loraPreset) string {
+	var parts []string
+	for _, l := range loras {
+		if t := strings.TrimSpace(l.Trigger); t != "" && !strings.Contains(strings.ToLower(prompt), strings.ToLower(t)) {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(append(parts, prompt), ", ")
+}
+
+// sameLora reports whether a and b are the same LoRA, library LoRAs go by name
+func sameLora(a, b loraPreset) bool {
+	if a.Name != "" || b.Name != "" {
+		return a.Name == b.Name
+	}
+	return a == b
+}
+
+// loraChoices returns the LoRAs the picker offers: the library's, then the
+// selected ones that aren't in it
+func (m newModel) loraChoices() []loraPreset {
+	choices := slices.Clone(m.config.LoraLibrary)
+	for _, l := range m.config.Loras {
+		if m.loraIndex(choices, l) < 0 {
+			choices = append(choices, l)
+		}
+	}
+	return choices
+}
+
+// loraIndex returns where the LoRA is in loras, -1 if it isn't
+func (m newModel) loraIndex(loras []loraPreset, l loraPreset) int {
+	return slices.IndexFunc(loras, func(o loraPreset) bool { return sameLora(o, l) })
+}
+
+// openLoraPicker shows the LoRA picker
+func (m newModel) openLoraPicker() (newModel, tea.Cmd) {
+	m.loraOptions = m.loraChoices()
+	if len(m.loraOptions) == 0 {
+		return m, m.showToast("⚠️ No LoRAs, add them under loras in the config file or use --lora")
+	}
+	m.pickingLora = true
+	m.loraCursor = 0
+	m.textInput.Blur()
+	return m, nil
+}
+
+// loraPickerKeys relabels the bindings of the LoRA picker
+func (m newModel) loraPickerKeys() (toggle, done key.Binding) {
+	toggle, done = m.keys.Select, m.keys.Back
+	toggle.SetHelp(toggle.Help().Key, "Toggle")
+	done.SetHelp(done.Help().Key, "Done")
+	return toggle, done
+}
+
+// updateLoraPicker handles key presses while the LoRA picker is open
+func (m newModel) updateLoraPicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	choices := m.loraOptions
+	toggle, done := m.loraPickerKeys()
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		m.loraCursor = (m.loraCursor + len(choices) - 1) % len(choices)
+	case key.Matches(msg, m.keys.Down):
+		m.loraCursor = (m.loraCursor + 1) % len(choices)
+	case key.Matches(msg, toggle):
+		// Queued prompts keep the LoRAs they were submitted with
+		c := *m.config
+		l := choices[m.loraCursor]
+		if i := m.loraIndex(m.config.Loras, l); i >= 0 {
+			c.Loras = slices.Delete(slices.Clone(c.Loras), i, i+1)
+		} else {
+			c.Loras = append(slices.Clone(c.Loras), l)
+		}
+		m.config = &c
+	case key.Matches(msg, done):
+		m.pickingLora = false
+		return m, m.textInput.Focus()
+	}
+	return m, nil
+}
+
+func (m newModel) loraPickerView() string {
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Render("🧩 LoRAs")
+
+	choices := m.loraOptions
+	nameWidth := 0
+	for _, l := range choices {
+		nameWidth = max(nameWidth, lipgloss.Width(l.label()))
+	}
+
+	rows := make([]string, 0, len(choices))
+	for i, l := range choices {
+		check := "[ ]"
+		if m.loraIndex(m.config.Loras, l) >= 0 {
+			check = "[✓]"
+		}
+		row := fmt.Sprintf("%s %-*s  %s", check, nameWidth, l.label(), l.Description)
+		if i == m.loraCursor {
+			rows = append(rows, highlight(accentColor).
+				Render("▸ "+row))
+		} else {
+			rows = append(rows, lipgloss.NewStyle().
+				Foreground(textColor).
+				Render("  "+row))
+		}
+	}
+
+	l := choices[m.loraCursor]
+	info := []string{l.Weights, fmt.Sprintf("scale: %g", l.scale())}
+	if l.Trigger != "" {
+		info = append(info, "trigger: "+l.Trigger)
+	}
+	details := lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Width(min(70, m.width-8)).
+		Render(strings.Join(info, " • "))
+
+	toggle, done := m.loraPickerKeys()
+	hint := lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Render(m.hint(m.keys.Up, m.keys.Down, toggle, done))
+
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		"",
+		strings.Join(rows, "\n"),
+		"",
+		details,
+		"",
+		hint,
+	)
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(primaryColor).
+		Padding(1, 2).
+		Render(content)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/spf13/cobra"
+)
+
+// generateImageInput is the input of the generate_image MCP tool
+type generateImageInput struct {
+	Prompt      string `json:"prompt" jsonschema:"description of the image to generate"`
+	Model       string `json:"model,omitempty" jsonschema:"FLUX model to use: schnell (fast and cheap), dev, pro (best quality) or pro-1.1 (takes exact sizes)"`
+	AspectRatio string `json:"aspect_ratio,omitempty" jsonschema:"aspect ratio of the image e.g. 1:1, 16:9, 9:16, 4:3, 3:4, 3:2, 2:3, 4:5, 5:4, 21:9 or 9:21 (pro-1.1 has no 21:9 or 9:21)"`
+	Size        string `json:"size,omitempty" jsonschema:"size of the image e.g. 1344x768, rounded to what the model takes, overrides aspect_ratio (not for pro)"`
+	Format      string `json:"format,omitempty" jsonschema:"output image format: png, webp or jpg"`
+	Style       string `json:"style,omitempty" jsonschema:"name of a style preset to wrap the prompt with"`
+	Seed        int    `json:"seed,omitempty" jsonschema:"seed for reproducible generation, omit for a random seed"`
+}
+
+// listHistoryInput is the input of the list_history MCP tool
+type listHistoryInput struct {
+	Limit int `json:"limit,omitempty" jsonschema:"maximum number of images to return, newest first (default 20)"`
+}
+
+// listHistoryOutput is the output of the list_history MCP tool
+type listHistoryOutput struct {
+	Images []historyEntry `json:"images"`
+}
+
+// newMCPServer returns an MCP server exposing fluxy's image generation as tools
+func newMCPServer(c *config) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "fluxy", Title: "fluxy FLUX image generator", Version: buildVersion()}, nil)
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "generate_image",
+		Description: "Generate an image with a FLUX model on Replicate and save it to disk. Returns the saved file path and generation metadata.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, in generateImageInput) (*mcp.CallToolResult, historyEntry, error) {
+		rc, err := c.forRequest(generateRequest{
+			Prompt:      in.Prompt,
+			Model:       in.Model,
+			AspectRatio: in.AspectRatio,
+			Size:        in.Size,
+			Format:      in.Format,
+			Style:       in.Style,
+			Seed:        in.Seed,
+		})
+		if err != nil {
+			return nil, historyEntry{}, err
+		}
+		g, err := generate(in.Prompt, rc)
+		if err != nil {
+			return nil, historyEntry{}, err
+		}
+		path, err := saveGeneration(g, rc)
+		if path == "" {
+			return nil, historyEntry{}, err
+		}
+		if err != nil {
+			logger.Warn("Image saved but not added to history", "path", path, "err", err)
+		}
+		return nil, newHistoryEntry(g, path), nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_history",
+		Description: "List images previously generated and saved by fluxy, newest first, with their file paths and metadata.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, in listHistoryInput) (*mcp.CallToolResult, listHistoryOutput, error) {
+		limit := in.Limit
+		if limit <= 0 {
+			limit = 20
+		}
+		entries, err := loadHistory(limit)
+		if err != nil {
+			return nil, listHistoryOutput{}, err
+		}
+		if entries == nil {
+			entries = []historyEntry{}
+		}
+		return nil, listHistoryOutput{Images: entries}, nil
+	})
+
+	return server
+}
+
+// mcpCmd represents the mcp command
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Serve image generation as Model Context Protocol tools over stdio",
+	Long: `Serve image generation as Model Context Protocol (MCP) tools over stdio.
+
+Tools:
+  generate_image  generate and save an image (prompt, model, aspect_ratio, size, format, style, seed)
+  list_history    list previously saved images
+
+Example client configuration:
+  {"mcpServers": {"fluxy": {"command": "fluxy", "args": ["mcp", "-o", "/Users/me/Pictures/flux"]}}}`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			logger.Error("Invalid configuration", "err", err)
+			os.Exit(1)
+		}
+		if _, err := replicateToken(c); err != nil && c.Backend != backendMock {
+			logger.Error("Missing Replicate API token", "err", err)
+			os.Exit(1)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// stdout carries the protocol, so all logging goes to stderr
+		if err := newMCPServer(c).Run(ctx, &mcp.StdioTransport{}); err != nil && ctx.Err() == nil {
+			logger.Error("MCP server failed", "err", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mcpCmd)
+}
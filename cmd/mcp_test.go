@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newTestMCPClient connects a client to the MCP server over an in-memory
+// transport, generating with the mock backend into a temporary folder
+func newTestMCPClient(t *testing.T) (*mcp.ClientSession, *config) {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	logger.SetOutput(io.Discard)
+	t.Cleanup(func() { logger.SetOutput(os.Stderr) })
+	c := &config{
+		FluxModel:    "schnell",
+		AspectRatio:  "1:1",
+		OutputFormat: "png",
+		OutputFolder: t.TempDir(),
+		NameTemplate: defaultNameTemplate,
+		Safety:       defaultSafety,
+		Backend:      backendMock,
+	}
+
+	ctx := context.Background()
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := newMCPServer(c).Connect(ctx, st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ss.Close() })
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(ctx, ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.Close() })
+	return cs, c
+}
+
+// callTool calls the tool and decodes its structured output into v
+func callTool(t *testing.T, cs *mcp.ClientSession, name string, args map[string]any, v any) *mcp.CallToolResult {
+	t.Helper()
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: args})
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if v != nil && !res.IsError {
+		data, err := json.Marshal(res.StructuredContent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	return res
+}
+
+func TestMCPTools(t *testing.T) {
+	cs, c := newTestMCPClient(t)
+
+	tools, err := cs.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tools.Tools) != 2 || tools.Tools[0].Name != "generate_image" || tools.Tools[1].Name != "list_history" {
+		t.Errorf("got tools %+v", tools.Tools)
+	}
+
+	var e historyEntry
+	res := callTool(t, cs, "generate_image", map[string]any{"prompt": "a cat", "model": "dev", "seed": 7}, &e)
+	if res.IsError {
+		t.Fatalf("got error %+v", res.Content)
+	}
+	if e.Prompt != "a cat" || e.Model != "dev" || e.Seed != 7 || e.PredictionID == "" || filepath.Dir(e.Path) != c.OutputFolder {
+		t.Errorf("got image %+v", e)
+	}
+	if _, err := os.Stat(e.Path); err != nil {
+		t.Error(err)
+	}
+
+	// Bad input comes back as a tool error, not a protocol error
+	if res := callTool(t, cs, "generate_image", map[string]any{"prompt": "a cat", "model": "nope"}, nil); !res.IsError {
+		t.Error("expected an unknown model to fail")
+	}
+
+	var history listHistoryOutput
+	callTool(t, cs, "list_history", map[string]any{"limit": 5}, &history)
+	if len(history.Images) != 1 || history.Images[0].Path != e.Path {
+		t.Errorf("got history %+v", history.Images)
+	}
+}
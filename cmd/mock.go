@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"math/rand/v2"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+const (
+	backendReplicate = "replicate"
+	backendMock      = "mock"
+)
+
+// mockConfig configures the offline mock backend
+type mockConfig struct {
+	Latency  time.Duration // How long a generation takes
+	Fail     string        // Failure to inject: safety, timeout, 429, 422 or corrupt
+	FailRate float64       // Fraction of generations that fail
+}
+
+var (
+	validBackends  = []string{backendReplicate, backendMock}
+	validMockFails = []string{"safety", "timeout", "429", "422", "corrupt"}
+)
+
+// mockGenerate synthesizes a deterministic image locally instead of running a
+// prediction, going through the same statuses and failures as Replicate
+func mockGenerate(prompt string, c *config, progress func(Response)) (generation, error) {
+	userPrompt := prompt
+	prompt, c = c.styled(prompt)
+	prompt = withTriggers(prompt, c.Loras)
+
+	spec, err := modelFor(c)
+	if err != nil {
+		return generation{}, err
+	}
+	var input Input
+	if err := spec.inputs(c, &input); err != nil {
+		return generation{}, err
+	}
+
+	// Same prompt and seed, same image
+	seed := c.Seed
+	h := fnv.New64a()
+	h.Write([]byte(prompt))
+	if seed == 0 {
+		seed = int(h.Sum64() % 1_000_000_000)
+	}
+	h.Write([]byte(strconv.Itoa(seed)))
+	sum := h.Sum64()
+
+	result := Response{
+		ID:        fmt.Sprintf("mock-%016x", sum),
+		Model:     spec.Replicate,
+		Status:    "starting",
+		CreatedAt: time.Now(),
+	}
+	result.Input.Prompt = prompt
+	result.Input.Seed = seed
+	result.Input.AspectRatio = input.AspectRatio
+	result.Input.Width = input.Width
+	result.Input.Height = input.Height
+	result.Input.Megapixels = input.Megapixels
+	result.Input.OutputFormat = c.OutputFormat
+
+	fail := ""
+	if c.Mock.Fail != "" && rand.Float64() < c.Mock.FailRate {
+		fail = c.Mock.Fail
+	}
+	switch fail {
+	case "429":
+		return generation{}, &statusError{Code: 429, Status: "429 Too Many Requests", Detail: "Request was throttled. Expected available in 1 second."}
+	case "422":
+		return generation{}, &statusError{Code: 422, Status: "422 Unprocessable Entity", Detail: "- input.aspect_ratio: aspect_ratio must be one of the following: \"1:1\", \"16:9\", \"3:2\""}
+	}
+
+	if progress != nil {
+		progress(result)
+	}
+	time.Sleep(c.Mock.Latency / 4)
+	result.Status = "processing"
+	if progress != nil {
+		progress(result)
+	}
+	time.Sleep(c.Mock.Latency - c.Mock.Latency/4)
+
+	switch fail {
+	case "timeout":
+		return generation{}, fmt.Errorf("error sending request: %w", &url.Error{
+			Op:  "Get",
+			URL: replicateAPI + "/predictions/" + result.ID,
+			Err: context.DeadlineExceeded,
+		})
+	case "safety":
+		// The most permissive settings get through, so retrying with them can be tried out
+		safety := c.safety()
+		if safety.relaxed(c.FluxModel, 1) == safety {
+			break
+		}
+		result.Status = "failed"
+		result.Error = "NSFW content detected. Try running it again, or try a different prompt."
+		if progress != nil {
+			progress(result)
+		}
+		return generation{}, &safetyError{Prompt: userPrompt, Model: c.FluxModel, Settings: safety, Reason: fmt.Sprint(result.Error)}
+	}
+
+	width, height := mockSize(input)
+	imageData, err := encodeImage(mockImage(width, height, sum), c.OutputFormat)
+	if err != nil {
+		return generation{}, err
+	}
+	if fail == "corrupt" {
+		// Like a download cut short
+		if err := checkImage(imageData[:len(imageData)/2], c.OutputFormat); err != nil {
+			return generation{}, err
+		}
+	}
+
+	result.Status = "succeeded"
+	if progress != nil {
+		progress(result)
+	}
+
+	return generation{
+		Image:        imageData,
+		PredictionID: result.ID,
+		Prompt:       userPrompt,
+		Style:        styleName(c.Style),
+		Model:        spec.Name,
+		Seed:         seed,
+		AspectRatio:  aspectOf(input.AspectRatio, input.Width, input.Height),
+		Format:       c.OutputFormat,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+// mockEnhance embellishes the prompt the way a text model might
+func mockEnhance(prompt string, c *config) string {
+	time.Sleep(c.Mock.Latency / 2)
+	return strings.TrimSpace(prompt) + ", highly detailed, soft natural light, shallow depth of field, rich color palette, sharp focus"
+}
+
+// mockSize returns the size of the image a model makes for the input, about
+// one megapixel with the aspect ratio unless it asks for a size
+func mockSize(input Input) (int, int) {
+	if input.Width > 0 && input.Height > 0 {
+		return input.Width, input.Height
+	}
+	w, h := 1.0, 1.0
+	if a, b, ok := strings.Cut(input.AspectRatio, ":"); ok {
+		if aw, err := strconv.ParseFloat(a, 64); err == nil && aw > 0 {
+			w = aw
+		}
+		if bh, err := strconv.ParseFloat(b, 64); err == nil && bh > 0 {
+			h = bh
+		}
+	}
+	megapixels := 1.0
+	if mp, err := strconv.ParseFloat(input.Megapixels, 64); err == nil && mp > 0 {
+		megapixels = mp
+	}
+	scale := math.Sqrt(megapixels * 1024 * 1024 / (w * h))
+	round := func(v float64) int { return max(16, int(math.Round(v/16))*16) }
+	return round(w * scale), round(h * scale)
+}
+
+// mockImage draws a soft gradient with a few glowing blobs and some grain
+func mockImage(width, height int, seed uint64) image.Image {
+	r := rand.New(rand.NewPCG(seed, seed>>1|1))
+	randomColor := func() [3]float64 {
+		return [3]float64{r.Float64() * 255, r.Float64() * 255, r.Float64() * 255}
+	}
+	from, to := randomColor(), randomColor()
+	angle := r.Float64() * 2 * math.Pi
+	dx, dy := math.Cos(angle), math.Sin(angle)
+
+	type blob struct {
+		x, y, radius float64
+		color        [3]float64
+	}
+	blobs := make([]blob, 3+r.IntN(4))
+	for i := range blobs {
+		blobs[i] = blob{
+			x:      r.Float64() * float64(width),
+			y:      r.Float64() * float64(height),
+			radius: (0.1 + r.Float64()*0.3) * float64(min(width, height)),
+			color:  randomColor(),
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			// Position along the gradient from 0 to 1
+			t := ((float64(x)/float64(width)-0.5)*dx+(float64(y)/float64(height)-0.5)*dy)/math.Sqrt2 + 0.5
+			var px [3]float64
+			for i := range px {
+				px[i] = from[i] + (to[i]-from[i])*t
+			}
+			for _, b := range blobs {
+				d := math.Hypot(float64(x)-b.x, float64(y)-b.y) / b.radius
+				if d < 1 {
+					w := (1 - d*d) * (1 - d*d) * 0.8
+					for i := range px {
+						px[i] += (b.color[i] - px[i]) * w
+					}
+				}
+			}
+			grain := (r.Float64() - 0.5) * 24
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(max(0, min(255, px[0]+grain))),
+				G: uint8(max(0, min(255, px[1]+grain))),
+				B: uint8(max(0, min(255, px[2]+grain))),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// encodeImage encodes the image in the output format
+func encodeImage(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case "webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		return nil, fmt.Errorf("invalid output format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %s image: %w", format, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	fluxSchnellModel     = "black-forest-labs/flux-schnell"
+	fluxProModel         = "black-forest-labs/flux-1.1-pro-ultra"
+	fluxDevModel         = "black-forest-labs/flux-dev"
+	fluxPro11Model       = "black-forest-labs/flux-1.1-pro"
+	fluxDevLoraModel     = "black-forest-labs/flux-dev-lora"
+	fluxSchnellLoraModel = "black-forest-labs/flux-schnell-lora"
+)
+
+// modelSpec is a model fluxy generates with and the inputs it accepts
+type modelSpec struct {
+	Name         string   // fluxy's name for it, e.g. pro
+	Replicate    string   // Replicate model
+	AspectRatios []string // aspect_ratio values
+	Megapixels   []string // megapixels values, if it takes them
+	// Width and height, if it takes them, are multiples of Multiple between MinSize and MaxSize
+	Multiple, MinSize, MaxSize int
+	Tolerance                  toleranceRange // safety_tolerance, none if it has a safety checker instead
+	Safety                     safetySettings // sent when the config file doesn't say otherwise
+	Raw                        bool           // takes raw, for a less processed, photographic look
+	ImagePrompt                bool           // takes an image_prompt guiding the style and composition
+	ImagePromptStrength        bool           // takes an image_prompt_strength for it
+	Loras                      int            // how many LoRAs it takes
+	LoraModel                  string         // model generations with LoRAs use instead
+}
+
+// fluxAspectRatios are the aspect ratios most FLUX models take
+var fluxAspectRatios = []string{"1:1", "16:9", "21:9", "3:2", "2:3", "4:5", "5:4", "3:4", "4:3", "9:16", "9:21"}
+
+// fluxModels is the model registry, in the order the TUI cycles through them
+var fluxModels = []modelSpec{
+	{
+		Name:         "schnell",
+		Replicate:    fluxSchnellModel,
+		AspectRatios: fluxAspectRatios,
+		Megapixels:   []string{"1", "0.25"},
+		Safety:       safetySettings{DisableChecker: true},
+		LoraModel:    "schnell-lora",
+	},
+	{
+		Name:                "pro",
+		Replicate:           fluxProModel,
+		AspectRatios:        fluxAspectRatios,
+		Tolerance:           toleranceRange{1, 6},
+		Safety:              safetySettings{Tolerance: 5},
+		Raw:                 true,
+		ImagePrompt:         true,
+		ImagePromptStrength: true,
+	},
+	{
+		Name:         "dev",
+		Replicate:    fluxDevModel,
+		AspectRatios: fluxAspectRatios,
+		Megapixels:   []string{"1", "0.25"},
+		LoraModel:    "dev-lora",
+	},
+	{
+		Name:         "pro-1.1",
+		Replicate:    fluxPro11Model,
+		AspectRatios: []string{"1:1", "16:9", "3:2", "2:3", "4:5", "5:4", "3:4", "4:3", "9:16"},
+		Multiple:     32,
+		MinSize:      256,
+		MaxSize:      1440,
+		Tolerance:    toleranceRange{1, 6},
+		Safety:       safetySettings{Tolerance: 5},
+		ImagePrompt:  true,
+	},
+	{
+		Name:         "dev-lora",
+		Replicate:    fluxDevLoraModel,
+		AspectRatios: fluxAspectRatios,
+		Megapixels:   []string{"1", "0.25"},
+		Loras:        2,
+	},
+	{
+		Name:         "schnell-lora",
+		Replicate:    fluxSchnellLoraModel,
+		AspectRatios: fluxAspectRatios,
+		Megapixels:   []string{"1", "0.25"},
+		Safety:       safetySettings{DisableChecker: true},
+		Loras:        2,
+	},
+}
+
+// validFluxModels are the names of the models in the registry
+var validFluxModels = func() []string {
+	names := make([]string, 0, len(fluxModels))
+	for _, m := range fluxModels {
+		names = append(names, m.Name)
+	}
+	return names
+}()
+
+// findModel returns the model fluxy calls name
+func findModel(name string) (*modelSpec, error) {
+	for i := range fluxModels {
+		if fluxModels[i].Name == name {
+			return &fluxModels[i], nil
+		}
+	}
+	return nil, fmt.Errorf("invalid flux model %q (must be one of: %s)", name, strings.Join(validFluxModels, ", "))
+}
+
+// modelFor returns the model the config generates with, the model's LoRA
+// counterpart when the config has LoRAs
+func modelFor(c *config) (*modelSpec, error) {
+	spec, err := findModel(c.FluxModel)
+	if err != nil || len(c.Loras) == 0 || spec.LoraModel == "" {
+		return spec, err
+	}
+	return findModel(spec.LoraModel)
+}
+
+// fluxModelName returns the fluxy name (schnell, pro, ...) of a Replicate
+// model, or the model itself if it isn't one fluxy generates with
+func fluxModelName(model string) string {
+	for _, m := range fluxModels {
+		if m.Replicate == model {
+			return m.Name
+		}
+	}
+	return model
+}
+
+// checkAspect returns an error unless the model takes the aspect ratio
+func (s *modelSpec) checkAspect(aspect string) error {
+	if !slices.Contains(s.AspectRatios, aspect) {
+		return fmt.Errorf("invalid aspect ratio %q for %s (must be one of: %s)", aspect, s.Name, strings.Join(s.AspectRatios, ", "))
+	}
+	return nil
+}
+
+// checkAnyAspect returns an error unless one of the models takes the aspect ratio
+func checkAnyAspect(aspect string) error {
+	var all []string
+	for _, m := range fluxModels {
+		if slices.Contains(m.AspectRatios, aspect) {
+			return nil
+		}
+		for _, a := range m.AspectRatios {
+			if !slices.Contains(all, a) {
+				all = append(all, a)
+			}
+		}
+	}
+	return fmt.Errorf("invalid aspect ratio %q (must be one of: %s)", aspect, strings.Join(all, ", "))
+}
+
+// parseSize parses a size like 1344x768
+func parseSize(size string) (int, int, error) {
+	ws, hs, ok := strings.Cut(strings.ToLower(size), "x")
+	w, werr := strconv.Atoi(ws)
+	h, herr := strconv.Atoi(hs)
+	if !ok || werr != nil || herr != nil || w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q (must be WIDTHxHEIGHT, e.g. 1344x768)", size)
+	}
+	return w, h, nil
+}
+
+// sized sets the aspect ratio of the prediction's input and, when the config
+// asks for a size or megapixels, the model's inputs that get closest to it
+func (s *modelSpec) sized(c *config, input *Input) error {
+	invalid := func(format string, args ...any) error {
+		return &generationError{Kind: kindValidation, Err: fmt.Errorf(format, args...)}
+	}
+	if c.Megapixels != "" {
+		if len(s.Megapixels) == 0 {
+			return invalid("%s doesn't take megapixels, use --size or --aspect instead", s.Name)
+		}
+		if !slices.Contains(s.Megapixels, c.Megapixels) {
+			return invalid("invalid megapixels %q for %s (must be one of: %s)", c.Megapixels, s.Name, strings.Join(s.Megapixels, ", "))
+		}
+		input.Megapixels = c.Megapixels
+	}
+	if c.Size == "" {
+		if err := s.checkAspect(c.AspectRatio); err != nil {
+			return invalid("%w", err)
+		}
+		input.AspectRatio = c.AspectRatio
+		return nil
+	}
+
+	w, h, err := parseSize(c.Size)
+	if err != nil {
+		return invalid("%w", err)
+	}
+	switch {
+	case s.Multiple > 0:
+		input.AspectRatio = "custom"
+		input.Width, input.Height = s.fit(w, h)
+		if input.Width != w || input.Height != h {
+			log.Debug("Rounded the size to one the model takes", "model", s.Name, "size", c.Size, "to", fmt.Sprintf("%dx%d", input.Width, input.Height))
+		}
+	case len(s.Megapixels) > 0:
+		input.AspectRatio = nearest(s.AspectRatios, float64(w)/float64(h), aspectValue)
+		if input.Megapixels == "" {
+			input.Megapixels = nearest(s.Megapixels, float64(w*h)/1e6, func(mp string) float64 {
+				v, _ := strconv.ParseFloat(mp, 64)
+				return v
+			})
+		}
+		log.Debug("Using the closest aspect ratio and megapixels the model takes", "model", s.Name, "size", c.Size, "aspect", input.AspectRatio, "megapixels", input.Megapixels)
+	default:
+		return invalid("%s doesn't take a size, use --aspect instead (one of: %s)", s.Name, strings.Join(s.AspectRatios, ", "))
+	}
+	return nil
+}
+
+// fit scales the size into the model's limits, keeping its aspect ratio, and
+// rounds it to the nearest multiples the model takes
+func (s *modelSpec) fit(w, h int) (int, int) {
+	scale := 1.0
+	if long := max(w, h); long > s.MaxSize {
+		scale = float64(s.MaxSize) / float64(long)
+	} else if short := min(w, h); short < s.MinSize {
+		scale = float64(s.MinSize) / float64(short)
+	}
+	round := func(v int) int {
+		r := int(math.Round(float64(v)*scale/float64(s.Multiple))) * s.Multiple
+		return min(max(s.MinSize, r), s.MaxSize)
+	}
+	return round(w), round(h)
+}
+
+// nearest returns the choice whose value is closest to v on a log scale
+func nearest(choices []string, v float64, value func(string) float64) string {
+	best, bestDist := "", math.Inf(1)
+	for _, c := range choices {
+		if d := math.Abs(math.Log(value(c) / v)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// aspectValue returns the width over the height of an aspect ratio like 16:9
+func aspectValue(aspect string) float64 {
+	a, b, _ := strings.Cut(aspect, ":")
+	w, _ := strconv.ParseFloat(a, 64)
+	h, _ := strconv.ParseFloat(b, 64)
+	if w <= 0 || h <= 0 {
+		return 1
+	}
+	return w / h
+}
+
+// aspectOf returns the aspect ratio of the input, reduced from its width and
+// height when it was a custom size
+func aspectOf(aspect string, width, height int) string {
+	if aspect != "custom" || width <= 0 || height <= 0 {
+		return aspect
+	}
+	a, b := width, height
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return fmt.Sprintf("%d:%d", width/a, height/a)
+}
+
+// inputs sets the prediction's inputs that depend on what the model takes
+func (s *modelSpec) inputs(c *config, input *Input) error {
+	if err := s.sized(c, input); err != nil {
+		return err
+	}
+	if err := s.guided(c, input); err != nil {
+		return err
+	}
+	return s.withLoras(c, input)
+}
+
+// checkInputs returns an error unless the config's model (once its style is
+// applied) takes its aspect ratio, size and the other inputs it asks for
+func (c *config) checkInputs() error {
+	_, sc := c.styled("")
+	spec, err := modelFor(sc)
+	if err != nil {
+		return err
+	}
+	return spec.inputs(sc, new(Input))
+}
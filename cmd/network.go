@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+var (
+	// network flags
+	connectTimeout    time.Duration
+	requestTimeout    time.Duration
+	predictionTimeout time.Duration
+	retries           int
+)
+
+// errPredictionTimeout is returned when a prediction doesn't finish within --prediction-timeout
+var errPredictionTimeout = errors.New("prediction timed out")
+
+// retryBackoff is the wait before the first retry, it doubles every retry up to maxRetryWait
+var (
+	retryBackoff = 500 * time.Millisecond
+	maxRetryWait = 10 * time.Second
+)
+
+// setupNetwork sets the timeouts of fluxy's HTTP client
+func setupNetwork() error {
+	if connectTimeout < 0 || requestTimeout < 0 || predictionTimeout < 0 {
+		return fmt.Errorf("timeouts can't be negative")
+	}
+	if retries < 0 {
+		return fmt.Errorf("invalid retries %d (must be at least 0)", retries)
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	t.TLSHandshakeTimeout = connectTimeout
+	httpClient.Transport = t
+	httpClient.Timeout = requestTimeout
+	return nil
+}
+
+// temporary marks an error that's worth retrying, after the wait the server asked for if any
+type temporary struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *temporary) Error() string { return e.err.Error() }
+func (e *temporary) Unwrap() error { return e.err }
+
+// withRetries calls try until it succeeds or fails with an error that isn't temporary,
+// backing off between attempts, and gives up after --retries retries
+func withRetries(what string, try func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := try()
+		var t *temporary
+		if err == nil || !errors.As(err, &t) {
+			return err
+		}
+		if attempt >= retries {
+			return t.err
+		}
+		wait := retryBackoff << attempt
+		wait += rand.N(wait/2 + 1) // jitter so parallel jobs don't retry in lockstep
+		if t.retryAfter > 0 {
+			wait = t.retryAfter
+		}
+		wait = min(wait, maxRetryWait)
+		log.Debug("Retrying", "what", what, "attempt", attempt+1, "wait", wait, "err", t.err)
+		time.Sleep(wait)
+	}
+}
+
+// apiError returns the error for a failed API response. Rate limited requests
+// are never carried out so they're always retried, server errors only when
+// the request is idempotent
+func apiError(resp *http.Response, body []byte, idempotent bool) error {
+	detail := strings.TrimSpace(string(body))
+	// Replicate's errors are problem details, the detail is the readable part
+	var problem struct {
+		Detail string `json:"detail"`
+	}
+	if json.Unmarshal(body, &problem) == nil && problem.Detail != "" {
+		detail = problem.Detail
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s: %s", errBadToken, resp.Status, detail)
+	}
+	err := &statusError{Code: resp.StatusCode, Status: resp.Status, Detail: detail}
+	if resp.StatusCode == http.StatusTooManyRequests || idempotent && retryableStatus(resp.StatusCode) {
+		return &temporary{err: err, retryAfter: retryAfter(resp)}
+	}
+	return err
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the wait the Retry-After header asks for, in seconds
+func retryAfter(resp *http.Response) time.Duration {
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return 0
+}
+
+// download fetches the URL, resuming an interrupted download with a Range request
+func download(url string) ([]byte, error) {
+	var data []byte
+	err := withRetries("download", func() error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		if len(data) > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(data)))
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return &temporary{err: fmt.Errorf("error fetching image: %w", err)}
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusPartialContent && len(data) > 0:
+			if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", len(data))) {
+				data = nil // start over
+				return &temporary{err: fmt.Errorf("error fetching image: unexpected range %q", resp.Header.Get("Content-Range"))}
+			}
+		case resp.StatusCode == http.StatusOK:
+			data = nil // the server sent the whole image
+		default:
+			err := fmt.Errorf("error fetching image: %s", resp.Status)
+			if retryableStatus(resp.StatusCode) {
+				return &temporary{err: err, retryAfter: retryAfter(resp)}
+			}
+			return err
+		}
+
+		chunk, err := io.ReadAll(resp.Body)
+		data = append(data, chunk...)
+		if err != nil {
+			log.Debug("Download interrupted", "url", url, "bytes", len(data), "err", err)
+			return &temporary{err: fmt.Errorf("error reading image data: %w", err)}
+		}
+		return nil
+	})
+	return data, err
+}
+
+// checkImage returns an error unless the data is a whole image in the format,
+// images in formats fluxy doesn't know aren't checked
+func checkImage(data []byte, format string) error {
+	var ok bool
+	switch format {
+	case "png":
+		ok = bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) && bytes.HasSuffix(data, []byte("IEND\xaeB`\x82"))
+	case "jpg", "jpeg":
+		// Some encoders pad the end of the image
+		ok = bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff}) && bytes.Contains(data[max(0, len(data)-16):], []byte{0xff, 0xd9})
+	case "webp":
+		ok = len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP" &&
+			int(binary.LittleEndian.Uint32(data[4:8]))+8 <= len(data)
+	default:
+		return nil
+	}
+	if !ok {
+		return &generationError{Kind: kindDecode, Err: fmt.Errorf("downloaded image is not a complete %s (got %d bytes of %s)", format, len(data), http.DetectContentType(data))}
+	}
+	return nil
+}
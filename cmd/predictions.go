@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// predictions flags
+	predictionsLimit int
+	predictionSave   bool
+)
+
+var predictionsCmd = &cobra.Command{
+	Use:     "predictions",
+	Aliases: []string{"preds"},
+	Short:   "List and fetch your Replicate predictions",
+	Long: `List and fetch your Replicate predictions.
+
+If fluxy exits before an image is downloaded the prediction keeps running on
+Replicate, use these commands to get the image back. Replicate removes the
+output of API predictions after an hour.`,
+}
+
+var predictionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List your most recent predictions",
+	Long: `List your most recent predictions, newest first.
+
+Pass --model to only list predictions of one FLUX model.`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if predictionsLimit < 1 {
+			return fmt.Errorf("invalid limit %d (must be at least 1)", predictionsLimit)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			logger.Error("Invalid configuration", "err", err)
+			os.Exit(1)
+		}
+		if c.Backend == backendMock {
+			logger.Error("Predictions are not available with the mock backend")
+			os.Exit(1)
+		}
+		token, err := replicateToken(c)
+		if err != nil {
+			logger.Error("Missing Replicate API token", "err", err)
+			os.Exit(1)
+		}
+
+		var keep func(Response) bool
+		if cmd.Flags().Changed("model") {
+			keep = func(r Response) bool { return fluxModelName(r.Model) == c.FluxModel }
+		}
+		predictions, err := listPredictions(token, predictionsLimit, keep)
+		if err != nil {
+			logger.Error("Failed to list predictions", "err", err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tMODEL\tSTATUS\tCREATED\tPROMPT")
+		for _, p := range predictions {
+			prompt := strings.Join(strings.Fields(p.Input.Prompt), " ")
+			if r := []rune(prompt); len(r) > 60 {
+				prompt = string(r[:59]) + "…"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.ID, fluxModelName(p.Model), p.Status, p.CreatedAt.Local().Format("2006-01-02 15:04"), prompt)
+		}
+		w.Flush()
+	},
+}
+
+var predictionsGetCmd = &cobra.Command{
+	Use:   "get <id>",
+	Short: "Download a prediction's image and open it in the viewer",
+	Long: `Download a prediction's image and open it in the viewer, or save it
+to --output with --save. A prediction that is still running is waited for.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			logger.Error("Invalid configuration", "err", err)
+			os.Exit(1)
+		}
+		if c.Backend == backendMock {
+			logger.Error("Predictions are not available with the mock backend")
+			os.Exit(1)
+		}
+		token, err := replicateToken(c)
+		if err != nil {
+			logger.Error("Missing Replicate API token", "err", err)
+			os.Exit(1)
+		}
+
+		result, err := getPrediction(token, args[0])
+		if err != nil {
+			logger.Error("Failed to get prediction", "id", args[0], "err", err)
+			os.Exit(1)
+		}
+		if !result.done() {
+			logger.Info("Waiting for prediction", "id", result.ID, "status", result.Status)
+			if result, err = waitForPrediction(token, result, nil); err != nil {
+				logger.Error("Failed to get prediction", "id", args[0], "err", err)
+				os.Exit(1)
+			}
+		}
+		if result.Status != "succeeded" {
+			logger.Error("Prediction did not succeed", "id", result.ID, "status", result.Status, "err", result.Error)
+			os.Exit(1)
+		}
+
+		imageData, err := downloadOutput(result)
+		if err != nil {
+			logger.Error("Failed to download image", "id", result.ID, "err", err)
+			os.Exit(1)
+		}
+		g := predictionGeneration(result, imageData)
+
+		if predictionSave {
+			path, err := saveGeneration(g, c)
+			if err != nil {
+				logger.Error("Failed to save image", "err", err)
+				os.Exit(1)
+			}
+			fmt.Println(path)
+			return
+		}
+
+		useTheme(c)
+		detectGraphics()
+		release := holdLogs()
+		p := tea.NewProgram(newViewerModel(c, g), tea.WithAltScreen(), tea.WithMouseCellMotion())
+		_, err = p.Run()
+		release()
+		if err != nil {
+			logger.Error("Error running program", "error", err)
+			os.Exit(1)
+		}
+		completePrediction(result.ID)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(predictionsCmd)
+	predictionsCmd.AddCommand(predictionsListCmd)
+	predictionsCmd.AddCommand(predictionsGetCmd)
+
+	predictionsListCmd.Flags().IntVarP(&predictionsLimit, "limit", "n", 20, "Number of predictions to list")
+	predictionsGetCmd.Flags().BoolVar(&predictionSave, "save", false, "Save the image to --output instead of opening it")
+}
@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/v2/key"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// queueJob is a prompt submitted to the TUI's generation queue
+type queueJob struct {
+	id      int
+	prompt  string
+	config  *config // settings when the prompt was submitted
+	status  string  // queued, then the Replicate status (starting, processing, succeeded or failed)
+	started bool
+	result  generation
+	err     error
+}
+
+func (j queueJob) done() bool {
+	return j.status == jobSucceeded || j.status == jobFailed
+}
+
+// jobStatusMsg reports a status change of a running job
+type jobStatusMsg struct {
+	id     int
+	status string
+}
+
+// jobDoneMsg is the outcome of a job
+type jobDoneMsg struct {
+	id  int
+	g   generation
+	err error
+}
+
+// startJobsMsg starts queued jobs, it's used to kick off the prompt given on the command line
+type startJobsMsg struct{}
+
+// submitJob adds the prompt to the queue with a snapshot of the current settings
+func (m newModel) submitJob(prompt string) (newModel, tea.Cmd) {
+	c := *m.config
+	m.nextJobID++
+	m.jobs = append(m.jobs, queueJob{
+		id:     m.nextJobID,
+		prompt: prompt,
+		config: &c,
+		status: jobQueued,
+	})
+	m.jobCursor = len(m.jobs) - 1
+	return m.startJobs()
+}
+
+// generateActive queues the prompt and waits for it in the loading view
+func (m newModel) generateActive(prompt string) (newModel, tea.Cmd) {
+	m, cmd := m.submitJob(prompt)
+	m.activeJob = m.nextJobID
+	m.generating = true
+	return m, tea.Batch(cmd, m.spinner.Tick)
+}
+
+// regenerate queues the current prompt again and waits for it
+func (m newModel) regenerate() (newModel, tea.Cmd) {
+	// Clear everything and mark for clearing on next render
+	clearImages()            // Clear all images from terminal immediately
+	m.imageData = []byte{}   // Clear cached image data FIRST
+	m.needsImageClear = true // Force clearing on next render
+	m.isRegenerating = true  // Mark as regeneration
+	m, cmd := m.generateActive(m.prompt)
+	return m, tea.Batch(tea.ClearScreen, cmd)
+}
+
+// startJobs starts queued jobs while fewer than the concurrency limit are running
+func (m newModel) startJobs() (newModel, tea.Cmd) {
+	running := 0
+	for _, j := range m.jobs {
+		if j.started && !j.done() {
+			running++
+		}
+	}
+	var cmds []tea.Cmd
+	for i := range m.jobs {
+		if running >= max(1, m.config.Concurrency) {
+			break
+		}
+		if !m.jobs[i].started {
+			m.jobs[i].started = true
+			running++
+			cmds = append(cmds, runJob(m.jobs[i], m.jobUpdates))
+		}
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// generateFunc generates the images of queued jobs
+var generateFunc = generateWithProgress
+
+// runJob generates the job's image, sending status changes to updates
+func runJob(j queueJob, updates chan<- jobStatusMsg) tea.Cmd {
+	return func() tea.Msg {
+		status := j.status
+		g, err := generateFunc(j.prompt, j.config, func(r Response) {
+			if r.Status != status {
+				status = r.Status
+				updates <- jobStatusMsg{id: j.id, status: status}
+			}
+		})
+		return jobDoneMsg{id: j.id, g: g, err: err}
+	}
+}
+
+// listenJobs waits for the next status change of a running job
+func listenJobs(updates <-chan jobStatusMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-updates
+	}
+}
+
+// job returns the index of the job with the given id or -1
+func (m newModel) job(id int) int {
+	for i, j := range m.jobs {
+		if j.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// finishJob records the outcome of a job, shows it if it's the one being waited on and starts the next
+func (m newModel) finishJob(msg jobDoneMsg) (newModel, tea.Cmd) {
+	i := m.job(msg.id)
+	if i < 0 {
+		return m, nil
+	}
+	if msg.err != nil {
+		m.jobs[i].status = jobFailed
+		m.jobs[i].err = msg.err
+	} else {
+		m.jobs[i].status = jobSucceeded
+		m.jobs[i].result = msg.g
+	}
+
+	m, cmd := m.startJobs()
+	if m.generating && msg.id == m.activeJob {
+		if msg.err != nil {
+			return m.showError(msg.err), cmd
+		}
+		return m.showGeneration(msg.g), cmd
+	}
+	if msg.err != nil {
+		return m, tea.Batch(cmd, m.showToast(fmt.Sprintf("⚠️ Job #%d failed: %v", msg.id, msg.err)))
+	}
+	return m, tea.Batch(cmd, m.showToast(m.withHint(fmt.Sprintf("✅ Job #%d finished", msg.id), m.keys.Queue)))
+}
+
+// showGeneration displays a finished generation in the image viewer
+func (m newModel) showGeneration(g generation) newModel {
+	m.imageData = g.Image
+	m.result = g
+	m.prompt = g.Prompt
+	m.generating = false
+	m.isRegenerating = false
+	m.inputMode = false
+	m.zooming = false
+	m.needsImageClear = true // ALWAYS clear on new image data - this fixes regeneration
+	m.imageRendered = false
+
+	// Ensure controls are properly focused when we get image data
+	m.selectedBtn = 0  // Default to regenerate button
+	m.textInput.Blur() // Ensure text input doesn't have focus
+	return m
+}
+
+// newPrompt goes back to the prompt input, queued jobs keep running
+func (m newModel) newPrompt() (newModel, tea.Cmd) {
+	clearImages()
+	m.generating = false
+	m.isRegenerating = false
+	m.viewingQueue = false
+	m.inputMode = true
+	m.needsImageClear = true
+	return m, tea.Batch(tea.ClearScreen, m.textInput.Focus())
+}
+
+// openQueue shows the job queue
+func (m newModel) openQueue() (newModel, tea.Cmd) {
+	clearImages() // Images are drawn outside of the UI, so remove it before showing the queue
+	m.viewingQueue = true
+	m.textInput.Blur()
+	return m, tea.ClearScreen
+}
+
+// closeQueue goes back to whatever was shown before the queue
+func (m newModel) closeQueue() (newModel, tea.Cmd) {
+	m.viewingQueue = false
+	m.needsImageClear = true
+	m.imageRendered = false
+	if m.inputMode {
+		return m, tea.Batch(tea.ClearScreen, m.textInput.Focus())
+	}
+	return m, tea.ClearScreen
+}
+
+// updateQueue handles key presses while the job queue is shown
+func (m newModel) updateQueue(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if len(m.jobs) > 0 {
+			m.jobCursor = (m.jobCursor + len(m.jobs) - 1) % len(m.jobs)
+		}
+	case key.Matches(msg, m.keys.Down):
+		if len(m.jobs) > 0 {
+			m.jobCursor = (m.jobCursor + 1) % len(m.jobs)
+		}
+	case key.Matches(msg, m.keys.Select):
+		if m.jobCursor >= len(m.jobs) {
+			return m, nil
+		}
+		j := m.jobs[m.jobCursor]
+		switch j.status {
+		case jobSucceeded:
+			m.viewingQueue = false
+			return m.showGeneration(j.result), tea.ClearScreen
+		case jobFailed:
+			return m, m.showToast(fmt.Sprintf("⚠️ Job #%d failed: %v", j.id, j.err))
+		default:
+			// Wait for it in the loading view
+			m.viewingQueue = false
+			m.inputMode = false
+			m.activeJob = j.id
+			m.generating = true
+			return m, tea.Batch(tea.ClearScreen, m.spinner.Tick)
+		}
+	case key.Matches(msg, m.keys.NewPrompt):
+		return m.newPrompt()
+	case key.Matches(msg, m.keys.Back, m.keys.Queue):
+		return m.closeQueue()
+	case key.Matches(msg, m.keys.Quit):
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// queueSummary returns a one line count of the jobs by status
+func (m newModel) queueSummary() string {
+	var queued, running, done, failed int
+	for _, j := range m.jobs {
+		switch j.status {
+		case jobQueued:
+			queued++
+		case jobSucceeded:
+			done++
+		case jobFailed:
+			failed++
+		default:
+			running++
+		}
+	}
+	parts := []string{fmt.Sprintf("%d running", running), fmt.Sprintf("%d queued", queued), fmt.Sprintf("%d done", done)}
+	if failed > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", failed))
+	}
+	return "📋 Queue: " + strings.Join(parts, " • ")
+}
+
+func statusIcon(status string) string {
+	switch status {
+	case jobQueued:
+		return "⏳"
+	case jobSucceeded:
+		return "✅"
+	case jobFailed:
+		return "❌"
+	default:
+		return "⚙️"
+	}
+}
+
+func (m newModel) queueView() string {
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Render("📋 Generation Queue")
+
+	width := max(30, min(80, m.width-8))
+	var rows []string
+	if len(m.jobs) == 0 {
+		rows = append(rows, lipgloss.NewStyle().Foreground(mutedColor).Render("No prompts submitted yet"))
+	}
+	for i, j := range m.jobs {
+		prompt := truncate(j.prompt, width-24)
+		row := fmt.Sprintf("%s #%-3d %-10s %s", statusIcon(j.status), j.id, j.status, prompt)
+		if i == m.jobCursor {
+			rows = append(rows, highlight(accentColor).
+				Render("▸ "+row))
+		} else {
+			rows = append(rows, lipgloss.NewStyle().
+				Foreground(textColor).
+				Render("  "+row))
+		}
+	}
+
+	var details string
+	if m.jobCursor < len(m.jobs) {
+		j := m.jobs[m.jobCursor]
+		info := []string{"model: " + j.config.FluxModel, "aspect: " + j.config.AspectRatio}
+		if j.config.Size != "" {
+			info[1] = "size: " + j.config.Size
+		}
+		if s := styleName(j.config.Style); s != "" {
+			info = append(info, "style: "+s)
+		}
+		details = strings.Join(info, " • ")
+		if j.err != nil {
+			details += "\n" + lipgloss.NewStyle().Foreground(errorColor).Render(j.err.Error())
+		}
+		details = lipgloss.NewStyle().
+			Foreground(mutedColor).
+			Width(width).
+			Render(details)
+	}
+
+	hint := lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Render(m.hint(m.keys.Up, m.keys.Down, m.keys.Select, m.keys.NewPrompt, m.keys.Back))
+
+	toast := lipgloss.NewStyle().
+		Foreground(warningColor).
+		Width(width).
+		Render(m.toast)
+
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		"",
+		lipgloss.NewStyle().Foreground(mutedColor).Render(m.queueSummary()),
+		"",
+		strings.Join(rows, "\n"),
+		"",
+		details,
+		"",
+		hint,
+		toast,
+	)
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(primaryColor).
+		Padding(1, 2).
+		Render(content)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
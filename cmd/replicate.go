@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// replicateAPI is the Replicate API base URL, FLUXY_REPLICATE_API points fluxy
+// at another server such as a replicatetest fake
+var replicateAPI = cmp.Or(os.Getenv("FLUXY_REPLICATE_API"), "https://api.replicate.com/v1")
+
+// httpClient sends fluxy's HTTP requests, --http-trace and --har trace them through its transport
+var httpClient = &http.Client{}
+
+// pollInterval is how often running predictions are polled
+var pollInterval = 1 * time.Second
+
+// modelPredictionsURL returns the endpoint that creates predictions of an official model
+func modelPredictionsURL(model string) string {
+	return replicateAPI + "/models/" + model + "/predictions"
+}
+
+// createPrediction starts a prediction at the given predictions endpoint. It's
+// only retried when rate limited, another attempt could start a second prediction
+func createPrediction(url, token string, input any) (Response, error) {
+	var result Response
+
+	jsonPayload, err := json.Marshal(map[string]any{"input": input})
+	if err != nil {
+		return result, fmt.Errorf("error marshaling JSON: %w", err)
+	}
+
+	err = withRetries("create prediction", func() error {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(jsonPayload))
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("error sending request: %w", err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("error reading response: %w", err)
+		}
+
+		log.Debug("API response", "body", string(body)+"\n")
+
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			return apiError(resp, body, false)
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return fmt.Errorf("error unmarshaling JSON: %w", err)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// getJSON sends an authorized GET request and decodes the JSON response into v,
+// retrying network and server errors
+func getJSON(url, token string, v any) error {
+	return withRetries("get "+url, func() error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return &temporary{err: fmt.Errorf("error sending request: %w", err)}
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return &temporary{err: fmt.Errorf("error reading response: %w", err)}
+		}
+
+		log.Debug("API response", "body", string(body)+"\n")
+
+		if resp.StatusCode != http.StatusOK {
+			return apiError(resp, body, true)
+		}
+		if err := json.Unmarshal(body, v); err != nil {
+			return fmt.Errorf("error unmarshaling JSON: %w", err)
+		}
+		return nil
+	})
+}
+
+// waitForPrediction polls the prediction until it succeeds, fails or is canceled,
+// calling progress (if set) after every poll. A prediction still running after
+// --prediction-timeout is canceled
+func waitForPrediction(token string, result Response, progress func(Response)) (Response, error) {
+	start := time.Now()
+	for !result.done() {
+		if predictionTimeout > 0 && time.Since(start) >= predictionTimeout {
+			return timedOut(token, result)
+		}
+		time.Sleep(pollInterval)
+
+		if err := getJSON(result.Urls.Get, token, &result); err != nil {
+			return result, err
+		}
+
+		log.Debug("Polling API", "status", result.Status)
+		if progress != nil {
+			progress(result)
+		}
+	}
+	return result, nil
+}
+
+// timedOut cancels a prediction that took too long and returns the timeout error
+func timedOut(token string, result Response) (Response, error) {
+	err := fmt.Errorf("%w: %s still %s after %s, --prediction-timeout waits longer", errPredictionTimeout, result.ID, result.Status, predictionTimeout)
+	canceled, cancelErr := cancelPrediction(token, result)
+	if cancelErr != nil {
+		log.Warn("Failed to cancel prediction", "id", result.ID, "err", cancelErr)
+		return result, &generationError{Kind: kindNetwork, Err: err}
+	}
+	return canceled, &generationError{Kind: kindNetwork, Err: fmt.Errorf("%w (canceled)", err)}
+}
+
+// cancelPrediction cancels a running prediction
+func cancelPrediction(token string, result Response) (Response, error) {
+	req, err := http.NewRequest("POST", result.Urls.Cancel, nil)
+	if err != nil {
+		return result, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return result, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return result, fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return result, apiError(resp, body, false)
+	}
+	var canceled Response
+	if err := json.Unmarshal(body, &canceled); err != nil {
+		return result, fmt.Errorf("error unmarshaling JSON: %w", err)
+	}
+	return canceled, nil
+}
+
+// getPrediction fetches a prediction by ID
+func getPrediction(token, id string) (Response, error) {
+	var result Response
+	err := getJSON(replicateAPI+"/predictions/"+url.PathEscape(id), token, &result)
+	return result, err
+}
+
+// maxPredictionPages is how many pages of predictions are searched when filtering
+const maxPredictionPages = 20
+
+// listPredictions returns up to limit of the account's most recent predictions,
+// newest first, keeping only the ones keep returns true for (all if keep is nil)
+func listPredictions(token string, limit int, keep func(Response) bool) ([]Response, error) {
+	var predictions []Response
+	next := replicateAPI + "/predictions"
+	for pages := 0; next != "" && len(predictions) < limit && pages < maxPredictionPages; pages++ {
+		var page predictionList
+		if err := getJSON(next, token, &page); err != nil {
+			return nil, err
+		}
+		for _, p := range page.Results {
+			if keep == nil || keep(p) {
+				predictions = append(predictions, p)
+			}
+		}
+		next = page.Next
+	}
+	return predictions[:min(limit, len(predictions))], nil
+}
@@ -22,10 +22,14 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"os"
+	"runtime/debug"
 	"slices"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea/v2"
 	"github.com/charmbracelet/lipgloss"
@@ -38,8 +42,21 @@ var (
 	logger       *log.Logger
 	verbose      bool
 	aspectRatio  string
+	imageSize    string
+	megapixels   string
 	outputFormat string
 	outputFolder string
+	nameTemplate string
+	configPath   string
+	autoEnhance  bool
+	enhanceModel string
+	concurrency  int
+	backend      string
+	mockLatency  time.Duration
+	mockFail     string
+	mockFailRate float64
+	promptStyle  string
+	themeName    string
 	apiToken     string
 	fluxModel    string
 	prompt       string
@@ -49,22 +66,6 @@ var (
 		"webp",
 		"jpg",
 	}
-	validAspectRatios = []string{
-		"1:1",
-		"16:9",
-		"21:9",
-		"2:3",
-		"3:2",
-		"4:5",
-		"5:4",
-		"9:16",
-		"9:21",
-	}
-	validFluxModels = []string{
-		"schnell",
-		"pro",
-		"dev",
-	}
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -72,45 +73,180 @@ var rootCmd = &cobra.Command{
 	Use:   "fluxy",
 	Short: "FLUX image generator TUI",
 	Args:  cobra.NoArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		// flags
-		if verbose {
-			log.SetLevel(log.DebugLevel)
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := setupNetwork(); err != nil {
+			logger.Error("Invalid configuration", "err", err)
+			os.Exit(1)
 		}
-		// validate flags
-		if !slices.Contains(validAspectRatios, aspectRatio) {
-			logger.Error(fmt.Sprintf("Invalid aspect ratio (must be one of: %s)", strings.Join(validAspectRatios, ", ")), "aspect", aspectRatio)
+		if err := setupLogging(); err != nil {
+			logger.Error("Invalid configuration", "err", err)
 			os.Exit(1)
 		}
-		if !slices.Contains(validOutputFormats, outputFormat) {
-			logger.Error(fmt.Sprintf("Invalid output format (must be one of: %s)", strings.Join(validOutputFormats, ", ")), "format", outputFormat)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			logger.Error("Invalid configuration", "err", err)
 			os.Exit(1)
 		}
-		if !slices.Contains(validFluxModels, fluxModel) {
-			logger.Error(fmt.Sprintf("Invalid flux model (must be one of: %s)", strings.Join(validFluxModels, ", ")), "model", fluxModel)
+		c.Prompt = prompt
+		c.AutoEnhance = autoEnhance
+		if concurrency < 1 {
+			logger.Error("Invalid configuration", "err", "concurrency must be at least 1")
+			os.Exit(1)
+		}
+		c.Concurrency = concurrency
+		if enhanceModel != "" {
+			c.Enhance.Model = enhanceModel
+		}
+		// Resolve the token before the TUI takes over the terminal, so a slow
+		// credential command runs once and is cached, a missing token is asked
+		// for in the TUI
+		if _, err := replicateToken(c); err != nil && !errors.Is(err, errNoToken) && c.Backend != backendMock {
+			logger.Error("Missing Replicate API token", "err", err)
 			os.Exit(1)
 		}
 		// run
-		p := tea.NewProgram(newInitialModel(&config{
-			Prompt:       prompt,
-			ApiToken:     apiToken,
-			AspectRatio:  aspectRatio,
-			OutputFormat: outputFormat,
-			OutputFolder: outputFolder,
-			FluxModel:    fluxModel,
-		}), tea.WithAltScreen(), tea.WithMouseCellMotion())
+		useTheme(c)
+		detectGraphics()
+		release := holdLogs()
+		p := tea.NewProgram(newInitialModel(c), tea.WithAltScreen(), tea.WithMouseCellMotion())
 		m, err := p.Run()
+		release()
 		if err != nil {
 			logger.Error("Error running program", "error", err)
 			os.Exit(1)
 		}
 		if m, ok := m.(newModel); ok {
-			// Note: saving is handled directly in the new TUI
-			_ = m
+			// Note: saving is handled directly in the new TUI, images that were
+			// shown but not saved were passed on, only unfinished ones are kept
+			// in the journal for recovery
+			for _, j := range m.jobs {
+				if j.status == jobSucceeded {
+					completePrediction(j.result.PredictionID)
+				}
+			}
 		}
 	},
 }
 
+// loadConfig validates the shared generation flags and merges them with the config file
+func loadConfig() (*config, error) {
+	if !slices.Contains(validOutputFormats, outputFormat) {
+		return nil, fmt.Errorf("invalid output format %q (must be one of: %s)", outputFormat, strings.Join(validOutputFormats, ", "))
+	}
+	if _, err := findModel(fluxModel); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(validBackends, backend) {
+		return nil, fmt.Errorf("invalid backend %q (must be one of: %s)", backend, strings.Join(validBackends, ", "))
+	}
+	if mockFail != "" && !slices.Contains(validMockFails, mockFail) {
+		return nil, fmt.Errorf("invalid mock failure %q (must be one of: %s)", mockFail, strings.Join(validMockFails, ", "))
+	}
+	if mockFailRate < 0 || mockFailRate > 1 {
+		return nil, fmt.Errorf("invalid mock failure rate %v (must be between 0 and 1)", mockFailRate)
+	}
+	if _, err := parseNameTemplate(nameTemplate); err != nil {
+		return nil, err
+	}
+	fc, err := loadConfigFile(cmp.Or(configPath, defaultConfigPath()))
+	if err != nil {
+		return nil, err
+	}
+	styles := styleLibrary(fc.Styles)
+	for _, s := range styles {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := newKeyMap(fc.Keys)
+	if err != nil {
+		return nil, err
+	}
+	var th *theme
+	if name := cmp.Or(themeName, fc.Theme, themeAuto); name != themeAuto {
+		if th, err = findTheme(themeLibrary(fc.Themes), name); err != nil {
+			return nil, err
+		}
+	}
+	safety, err := safetyLibrary(fc.Safety)
+	if err != nil {
+		return nil, err
+	}
+	if safetyTolerance != 0 || disableSafetyChecker.set {
+		s := safety[fluxModel]
+		if safetyTolerance != 0 {
+			s.Tolerance = safetyTolerance
+		}
+		if disableSafetyChecker.set {
+			s.DisableChecker = disableSafetyChecker.value
+		}
+		if err := s.validate(fluxModel); err != nil {
+			return nil, err
+		}
+		safety[fluxModel] = s
+	}
+	loraLib, err := loraLibrary(fc.Loras)
+	if err != nil {
+		return nil, err
+	}
+	var loras []loraPreset
+	for _, v := range loraFlags {
+		l, err := parseLora(v, loraLib)
+		if err != nil {
+			return nil, err
+		}
+		loras = append(loras, l)
+	}
+	var style *stylePreset
+	if promptStyle != "" {
+		if style, err = findStyle(styles, promptStyle); err != nil {
+			return nil, err
+		}
+	}
+	c := &config{
+		ApiToken:            apiToken,
+		CredentialCommand:   fc.CredentialCommand,
+		AspectRatio:         aspectRatio,
+		Size:                imageSize,
+		Megapixels:          megapixels,
+		Raw:                 rawMode,
+		ImagePrompt:         imagePrompt,
+		ImagePromptStrength: imagePromptStrength,
+		Loras:               loras,
+		LoraLibrary:         loraLib,
+		OutputFormat:        outputFormat,
+		OutputFolder:        outputFolder,
+		NameTemplate:        nameTemplate,
+		FluxModel:           fluxModel,
+		Enhance:             fc.Enhance,
+		Styles:              styles,
+		Style:               style,
+		Safety:              safety,
+		Backend:             backend,
+		Keys:                keys,
+		Theme:               th,
+		Mock: mockConfig{
+			Latency:  mockLatency,
+			Fail:     mockFail,
+			FailRate: mockFailRate,
+		},
+	}
+	if err := c.checkInputs(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// buildVersion returns fluxy's version from the build info
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -134,12 +270,42 @@ func init() {
 	logger = log.New(os.Stderr)
 	logger.SetStyles(styles)
 
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "V", false, "Verbose output")
+	// shared generation flags
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "V", false, "Verbose output")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, or error)")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Write logs to a file instead of the terminal")
+	rootCmd.PersistentFlags().BoolVar(&httpTrace, "http-trace", false, "Log every HTTP request and response (tokens redacted, images elided)")
+	rootCmd.PersistentFlags().StringVar(&harFile, "har", "", "Record HTTP requests and responses to a HAR file for bug reports")
+	rootCmd.PersistentFlags().DurationVar(&connectTimeout, "connect-timeout", 10*time.Second, "How long to wait for connections to Replicate (0 for no limit)")
+	rootCmd.PersistentFlags().DurationVar(&requestTimeout, "timeout", 2*time.Minute, "How long a single HTTP request may take (0 for no limit)")
+	rootCmd.PersistentFlags().DurationVar(&predictionTimeout, "prediction-timeout", 10*time.Minute, "How long to wait for a prediction to finish before canceling it (0 for no limit)")
+	rootCmd.PersistentFlags().IntVar(&retries, "retries", 3, "How many times failed polls and downloads are retried")
+	rootCmd.PersistentFlags().StringVarP(&aspectRatio, "aspect", "a", "1:1", "Aspect ratio of the image (16:9, 4:3, 1:1, etc, depending on the model)")
+	rootCmd.PersistentFlags().StringVar(&imageSize, "size", "", "Size of the image, e.g. 1344x768, rounded to what the model takes (overrides --aspect)")
+	rootCmd.PersistentFlags().StringVar(&megapixels, "megapixels", "", "Approximate megapixels of the image for schnell and dev (1 or 0.25)")
+	rootCmd.PersistentFlags().BoolVar(&rawMode, "raw", false, "Generate less processed, more natural-looking images (pro)")
+	rootCmd.PersistentFlags().StringVar(&imagePrompt, "image-prompt", "", "Path or URL of an image guiding the style and composition (pro and pro-1.1)")
+	rootCmd.PersistentFlags().Float64Var(&imagePromptStrength, "image-prompt-strength", 0.1, "How much the image prompt counts, from 0 (only the prompt) to 1 (pro)")
+	rootCmd.PersistentFlags().StringArrayVar(&loraFlags, "lora", nil, "LoRA to apply, a name from the config file, URL, hf:owner/name or Replicate model, with an optional :scale (repeatable, dev and schnell)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "format", "f", "png", "Output image format (png, webp, or jpg)")
+	rootCmd.PersistentFlags().StringVarP(&apiToken, "api-token", "t", "", "Replicate API token (overrides REPLICATE_API_TOKEN, REPLICATE_API_KEY and fluxy auth login)")
+	rootCmd.PersistentFlags().StringVarP(&fluxModel, "model", "m", "pro", "Model to use (schnell, pro, dev, pro-1.1, dev-lora, or schnell-lora)")
+	rootCmd.PersistentFlags().IntVar(&safetyTolerance, "safety-tolerance", 0, "Safety tolerance of pro and pro-1.1, 1 is the most strict and 6 the most permissive (default from the config file, or 5)")
+	rootCmd.PersistentFlags().Var(&disableSafetyChecker, "disable-safety-checker", "Disable the safety checker of schnell or dev (default from the config file, only schnell's is disabled)")
+	rootCmd.PersistentFlags().Lookup("disable-safety-checker").NoOptDefVal = "true"
+	rootCmd.PersistentFlags().StringVarP(&outputFolder, "output", "o", "", "Output folder")
+	rootCmd.PersistentFlags().StringVar(&nameTemplate, "name-template", defaultNameTemplate, "Filename template for saved images ('/' creates subfolders)")
+	rootCmd.PersistentFlags().StringVarP(&promptStyle, "style", "s", "", "Style preset to wrap prompts with")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Config file (default ~/.config/fluxy/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&themeName, "theme", "", "TUI theme (auto, dark, light, high-contrast, or one from the config file)")
+	rootCmd.PersistentFlags().StringVar(&backend, "backend", backendReplicate, "Image backend (replicate, or mock to generate placeholder images offline)")
+	rootCmd.PersistentFlags().DurationVar(&mockLatency, "mock-latency", 2*time.Second, "How long mock generations take")
+	rootCmd.PersistentFlags().StringVar(&mockFail, "mock-fail", "", "Failure mock generations inject (safety, timeout, 429, 422, or corrupt)")
+	rootCmd.PersistentFlags().Float64Var(&mockFailRate, "mock-fail-rate", 1, "Fraction of mock generations that fail with --mock-fail")
+	rootCmd.MarkPersistentFlagDirname("output")
+	// TUI flags
 	rootCmd.Flags().StringVarP(&prompt, "prompt", "p", "", "Prompt for image generation")
-	rootCmd.Flags().StringVarP(&aspectRatio, "aspect", "a", "1:1", "Aspect ratio of the image (16:9, 4:3, 1:1, etc)")
-	rootCmd.Flags().StringVarP(&outputFormat, "format", "f", "png", "Output image format (png, webp, or jpg)")
-	rootCmd.Flags().StringVarP(&apiToken, "api-token", "t", "", "Replicate API token (overrides REPLICATE_API_KEY env_var)")
-	rootCmd.Flags().StringVarP(&fluxModel, "model", "m", "pro", "Model to use (schnell, pro, or dev)")
-	rootCmd.Flags().StringVarP(&outputFolder, "output", "o", "", "Output folder")
-	rootCmd.MarkFlagDirname("output")
+	rootCmd.Flags().BoolVarP(&autoEnhance, "enhance", "e", false, "Enhance prompts with a text model before generating")
+	rootCmd.Flags().StringVar(&enhanceModel, "enhance-model", "", "Text model used to enhance prompts (overrides config)")
+	rootCmd.Flags().IntVarP(&concurrency, "concurrency", "c", 2, "Number of queued prompts to generate at once")
 }
@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/v2/key"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+var (
+	// safety flags
+	safetyTolerance      int
+	disableSafetyChecker optionalBool
+)
+
+// optionalBool is a bool flag that knows whether it was set
+type optionalBool struct{ set, value bool }
+
+func (b *optionalBool) String() string { return strconv.FormatBool(b.value) }
+func (b *optionalBool) Type() string   { return "bool" }
+
+func (b *optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	b.set, b.value = true, v
+	return nil
+}
+
+// safetySettings are the safety inputs sent to a model, set per model under
+// safety in the config file
+type safetySettings struct {
+	Tolerance      int  `yaml:"tolerance"`       // safety_tolerance, 1 is the most strict
+	DisableChecker bool `yaml:"disable_checker"` // disable_safety_checker
+}
+
+// toleranceRange is the safety_tolerance a model accepts, models without one
+// have a safety checker that can be disabled instead
+type toleranceRange struct{ Min, Max int }
+
+// toleranceOf returns the safety_tolerance range of the model in the registry
+func toleranceOf(model string) (toleranceRange, bool) {
+	spec, err := findModel(model)
+	if err != nil {
+		return toleranceRange{}, false
+	}
+	return spec.Tolerance, true
+}
+
+// defaultSafety is what's sent when the config file doesn't say otherwise
+var defaultSafety = func() map[string]safetySettings {
+	settings := make(map[string]safetySettings, len(fluxModels))
+	for _, m := range fluxModels {
+		settings[m.Name] = m.Safety
+	}
+	return settings
+}()
+
+// validate returns an error unless the model accepts the settings
+func (s safetySettings) validate(model string) error {
+	r, ok := toleranceOf(model)
+	switch {
+	case !ok:
+		return fmt.Errorf("invalid safety settings: unknown model %q", model)
+	case r.Max == 0 && s.Tolerance != 0:
+		return fmt.Errorf("invalid safety settings: %s has no safety tolerance, disable its safety checker instead", model)
+	case r.Max > 0 && (s.Tolerance < r.Min || s.Tolerance > r.Max):
+		return fmt.Errorf("invalid safety tolerance %d for %s (must be between %d and %d)", s.Tolerance, model, r.Min, r.Max)
+	case r.Max > 0 && s.DisableChecker:
+		return fmt.Errorf("invalid safety settings: %s's safety checker can't be disabled, raise its safety tolerance instead", model)
+	}
+	return nil
+}
+
+// describe describes the settings, e.g. "safety_tolerance 5 (1-6)"
+func (s safetySettings) describe(model string) string {
+	if r, _ := toleranceOf(model); r.Max > 0 {
+		return fmt.Sprintf("safety_tolerance %d (%d-%d)", s.Tolerance, r.Min, r.Max)
+	}
+	if s.DisableChecker {
+		return "safety checker off"
+	}
+	return "safety checker on"
+}
+
+// safetyLibrary returns the default safety settings overridden by the config file's
+func safetyLibrary(user map[string]safetySettings) (map[string]safetySettings, error) {
+	settings := maps.Clone(defaultSafety)
+	for _, model := range slices.Sorted(maps.Keys(user)) {
+		if err := user[model].validate(model); err != nil {
+			return nil, err
+		}
+		settings[model] = user[model]
+	}
+	return settings, nil
+}
+
+// safety returns the safety settings of the config's model
+func (c *config) safety() safetySettings {
+	if s, ok := c.Safety[c.FluxModel]; ok {
+		return s
+	}
+	return defaultSafety[c.FluxModel]
+}
+
+// withSafety returns a copy of the config with the model's safety settings replaced
+func (c *config) withSafety(model string, s safetySettings) *config {
+	sc := *c
+	sc.Safety = maps.Clone(c.Safety)
+	if sc.Safety == nil {
+		sc.Safety = maps.Clone(defaultSafety)
+	}
+	sc.Safety[model] = s
+	return &sc
+}
+
+// safetyError is returned when the safety filter blocks a prompt or its image
+type safetyError struct {
+	Prompt   string // Prompt as entered
+	Model    string
+	Settings safetySettings // Settings the prediction ran with
+	Reason   string
+	Blank    *generation // the blank image the checker's block was guessed from, if that's what happened
+}
+
+func (e *safetyError) Error() string {
+	return fmt.Sprintf("image generation failed: blocked by the safety filter with %s: %s", e.Settings.describe(e.Model), e.Reason)
+}
+
+// safetyRE matches the errors Replicate's models fail with when the safety filter trips
+var safetyRE = regexp.MustCompile(`(?i)nsfw|safety|flagged as sensitive|\bE005\b|content (policy|moderation)`)
+
+// isSafetyFailure reports whether a prediction's error is the safety filter's
+func isSafetyFailure(predictionErr any) bool {
+	return predictionErr != nil && safetyRE.MatchString(fmt.Sprint(predictionErr))
+}
+
+// blankImage reports whether the image is a single flat color, which is what
+// safety checkers replace flagged images with
+func blankImage(data []byte) bool {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	b := img.Bounds()
+	if b.Empty() {
+		return true
+	}
+	const samples = 32
+	r0, g0, b0, _ := img.At(b.Min.X, b.Min.Y).RGBA()
+	for y := range samples {
+		for x := range samples {
+			r, g, bl, _ := img.At(b.Min.X+x*b.Dx()/samples, b.Min.Y+y*b.Dy()/samples).RGBA()
+			// Allow a little noise from lossy formats
+			if diff(r, r0) > 0x800 || diff(g, g0) > 0x800 || diff(bl, b0) > 0x800 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func diff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// safetyBlocked returns the error when the safety filter blocked the prompt
+func (m newModel) safetyBlocked() (*safetyError, bool) {
+	var se *safetyError
+	ok := errors.As(m.err, &se)
+	return se, ok
+}
+
+// showError shows the error view, offering the current model for a retry or
+// more permissive safety settings when the safety filter blocked the prompt
+func (m newModel) showError(err error) newModel {
+	m.err = err
+	m.generating = false
+	m.errModel = m.config.FluxModel
+	if se, ok := m.safetyBlocked(); ok {
+		m.safety = se.Settings.relaxed(se.Model, 1)
+	}
+	return m
+}
+
+// relaxed returns the settings one step more (or, with a negative step, less) permissive
+func (s safetySettings) relaxed(model string, step int) safetySettings {
+	if r, _ := toleranceOf(model); r.Max > 0 {
+		s.Tolerance = min(max(r.Min, s.Tolerance+step), r.Max)
+	} else {
+		s.DisableChecker = step > 0
+	}
+	return s
+}
+
+// safetyKeys are the bindings of the safety filter's error view
+type safetyKeys struct {
+	Stricter, Permissive, Retry, Edit, Show, Help, Quit key.Binding
+}
+
+// safetyBindings relabels the bindings used on the safety filter's error view
+func (m newModel) safetyBindings() safetyKeys {
+	k := m.keys
+	relabel := func(b key.Binding, desc string) key.Binding {
+		b.SetHelp(b.Help().Key, desc)
+		return b
+	}
+	show := relabel(k.Yes, "Show anyway")
+	se, _ := m.safetyBlocked()
+	show.SetEnabled(se != nil && se.Blank != nil && show.Enabled())
+	return safetyKeys{
+		Stricter:   relabel(k.PrevButton, "Stricter"),
+		Permissive: relabel(k.NextButton, "More permissive"),
+		Retry:      relabel(k.Generate, "Retry"),
+		Edit:       relabel(k.NewPrompt, "Edit prompt"),
+		Show:       show,
+		Help:       k.Help,
+		Quit:       k.Quit,
+	}
+}
+
+// updateSafety handles key presses while the safety filter's error is shown
+func (m newModel) updateSafety(msg tea.KeyMsg, se *safetyError) (tea.Model, tea.Cmd) {
+	k := m.safetyBindings()
+	switch {
+	case key.Matches(msg, k.Quit):
+		return m, tea.Quit
+	case key.Matches(msg, k.Help):
+		return m.openHelp()
+	case key.Matches(msg, k.Stricter):
+		m.safety = m.safety.relaxed(se.Model, -1)
+	case key.Matches(msg, k.Permissive):
+		m.safety = m.safety.relaxed(se.Model, 1)
+	case key.Matches(msg, k.Retry):
+		// Later prompts keep the new settings
+		m.config = m.config.withSafety(se.Model, m.safety)
+		m.err = nil
+		m.prompt = se.Prompt
+		m.inputMode = false
+		return m.generateActive(se.Prompt)
+	case key.Matches(msg, k.Edit):
+		m.err = nil
+		m, cmd := m.newPrompt()
+		m.textInput.SetValue(se.Prompt)
+		m.textInput.CursorEnd()
+		return m, cmd
+	case key.Matches(msg, k.Show):
+		// The image was meant to be flat after all, treat it as a success
+		m.err = nil
+		if i := m.job(m.activeJob); i >= 0 && m.jobs[i].status == jobFailed {
+			m.jobs[i].status, m.jobs[i].result, m.jobs[i].err = jobSucceeded, *se.Blank, nil
+		}
+		return m.showGeneration(*se.Blank), tea.ClearScreen
+	}
+	return m, nil
+}
+
+// safetyView explains what the safety filter blocked and offers a retry with other settings
+func (m newModel) safetyView(se *safetyError) string {
+	box := lipgloss.NewStyle().
+		Foreground(errorColor).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(errorColor).
+		Padding(1).
+		Width(60).
+		Align(lipgloss.Center).
+		Render(strings.Join([]string{
+			lipgloss.NewStyle().Bold(true).Render("🚫 Blocked by the safety filter"),
+			"",
+			fmt.Sprintf("%s flagged the prompt with %s", se.Model, se.Settings.describe(se.Model)),
+			"",
+			lipgloss.NewStyle().Foreground(mutedColor).Render(strings.TrimSpace(se.Reason)),
+		}, "\n"))
+
+	retry := lipgloss.NewStyle().
+		Foreground(accentColor).
+		Render("Retry with ◀ " + m.safety.describe(se.Model) + " ▶")
+
+	k := m.safetyBindings()
+	hint := lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Render(m.hint(k.Stricter, k.Permissive, k.Retry, k.Edit, k.Show, k.Help, k.Quit))
+
+	content := lipgloss.JoinVertical(lipgloss.Center, box, "", retry, "", hint)
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, content)
+}
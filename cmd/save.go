@@ -0,0 +1,415 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/v2/key"
+	"github.com/charmbracelet/bubbles/v2/textinput"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+const toastDuration = 4 * time.Second
+
+// saveDialog holds the state of the in-TUI save dialog
+type saveDialog struct {
+	filename textinput.Model
+	folder   textinput.Model
+	focus    int  // 0: filename, 1: folder
+	confirm  bool // waiting for overwrite confirmation
+	err      error
+}
+
+// clearToastMsg clears the status toast if it is still the one that was shown
+type clearToastMsg struct {
+	id int
+}
+
+func newSaveDialog(g generation, c *config) saveDialog {
+	var d saveDialog
+
+	// The number is only taken once the image is saved
+	name, err := imageFilename(c.NameTemplate, g, int(saveCounter.Load())+1)
+	if err != nil {
+		d.err = err
+	} else if rel, err := filepath.Rel(c.OutputFolder, uniquePath(filepath.Join(c.OutputFolder, name))); err == nil {
+		name = rel
+	}
+
+	filename := textinput.New()
+	filename.Prompt = "File:   "
+	filename.CharLimit = 255
+	filename.SetWidth(48)
+	filename.SetValue(name)
+
+	folder := textinput.New()
+	folder.Prompt = "Folder: "
+	folder.Placeholder = "current directory"
+	folder.CharLimit = 4096
+	folder.SetWidth(48)
+	folder.SetValue(c.OutputFolder)
+
+	d.filename = filename
+	d.folder = folder
+	return d
+}
+
+// path returns the full path of the file the dialog will save to
+func (d saveDialog) path() string {
+	return filepath.Join(d.folder.Value(), d.filename.Value())
+}
+
+// setFocus moves input focus to the given field
+func (d *saveDialog) setFocus(field int) tea.Cmd {
+	d.focus = field
+	if field == 0 {
+		d.folder.Blur()
+		return d.filename.Focus()
+	}
+	d.filename.Blur()
+	return d.folder.Focus()
+}
+
+// openSaveDialog clears the image from the terminal and shows the save dialog
+func (m newModel) openSaveDialog() (newModel, tea.Cmd) {
+	clearImages() // Images are drawn outside of the UI, so remove it before showing the dialog
+	m.saving = true
+	m.save = newSaveDialog(m.result, m.config)
+	return m, tea.Batch(tea.ClearScreen, m.save.setFocus(0))
+}
+
+// closeSaveDialog hides the save dialog and redraws the image
+func (m newModel) closeSaveDialog() (newModel, tea.Cmd) {
+	m.saving = false
+	m.save = saveDialog{}
+	m.needsImageClear = true
+	m.imageRendered = false
+	return m, tea.ClearScreen
+}
+
+// saveKeys are the bindings of the save dialog
+type saveKeys struct {
+	PrevField, NextField, Save, Cancel, Overwrite, Keep, Help, Quit key.Binding
+}
+
+// saveBindings relabels the bindings used in the save dialog, keys that type
+// into its fields are left out
+func (m newModel) saveBindings() saveKeys {
+	k := m.keys
+	relabel := func(b key.Binding, desc string) key.Binding {
+		b.SetHelp(b.Help().Key, desc)
+		return b
+	}
+	return saveKeys{
+		PrevField: relabel(untyped(k.Up), "Previous field"),
+		NextField: relabel(untyped(k.Down), "Next field"),
+		Save:      relabel(untyped(k.Select), "Save"),
+		Cancel:    relabel(k.Back, "Cancel"),
+		Overwrite: relabel(k.Yes, "Overwrite"),
+		Keep:      relabel(k.No, "Don't overwrite"),
+		Help:      untyped(k.Help),
+		Quit:      untyped(k.Quit),
+	}
+}
+
+// updateSaveDialog handles key presses while the save dialog is open
+func (m newModel) updateSaveDialog(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	k := m.saveBindings()
+	switch {
+	case key.Matches(msg, k.Quit):
+		return m, tea.Quit
+	case key.Matches(msg, k.Help):
+		return m.openHelp()
+	}
+
+	if m.save.confirm {
+		switch {
+		case key.Matches(msg, k.Overwrite):
+			return m.writeImage(true)
+		case key.Matches(msg, k.Keep, k.Cancel):
+			m.save.confirm = false
+		}
+		return m, nil
+	}
+
+	switch {
+	case key.Matches(msg, k.Cancel):
+		return m.closeSaveDialog()
+	case key.Matches(msg, k.PrevField, k.NextField):
+		return m, m.save.setFocus((m.save.focus + 1) % 2)
+	case key.Matches(msg, k.Save):
+		if strings.TrimSpace(m.save.filename.Value()) == "" {
+			m.save.err = errors.New("filename cannot be empty")
+			return m, nil
+		}
+		return m.writeImage(false)
+	}
+
+	var cmd tea.Cmd
+	m.save.err = nil
+	if m.save.focus == 0 {
+		m.save.filename, cmd = m.save.filename.Update(msg)
+	} else {
+		m.save.folder, cmd = m.save.folder.Update(msg)
+	}
+	return m, cmd
+}
+
+// writeImage saves the image to the path in the dialog and reports the result in a toast
+func (m newModel) writeImage(overwrite bool) (tea.Model, tea.Cmd) {
+	path, err := saveImage(m.imageData, m.save.path(), overwrite)
+	if errors.Is(err, fs.ErrExist) {
+		m.save.confirm = true
+		return m, nil
+	}
+	if err != nil {
+		m.save.confirm = false
+		m.save.err = err
+		return m, nil
+	}
+	saveCounter.Add(1)
+	completePrediction(m.result.PredictionID)
+	toast := fmt.Sprintf("✨ Image saved: %s", path)
+	if err := recordHistory(m.result, path); err != nil {
+		toast += fmt.Sprintf(" (not added to history: %v)", err)
+	}
+	m, cmd := m.closeSaveDialog()
+	return m, tea.Batch(cmd, m.showToast(toast))
+}
+
+// showToast displays a status message for a few seconds
+func (m *newModel) showToast(text string) tea.Cmd {
+	m.toastID++
+	m.toast = text
+	id := m.toastID
+	return tea.Tick(toastDuration, func(time.Time) tea.Msg {
+		return clearToastMsg{id: id}
+	})
+}
+
+func (m newModel) saveDialogView() string {
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Render("💾 Save Image")
+
+	var status string
+	switch {
+	case m.save.confirm:
+		status = lipgloss.NewStyle().
+			Foreground(warningColor).
+			Render(fmt.Sprintf("%s already exists. Overwrite?", m.save.path()))
+	case m.save.err != nil:
+		status = lipgloss.NewStyle().
+			Foreground(errorColor).
+			Render(fmt.Sprintf("Error: %v", m.save.err))
+	}
+
+	k := m.saveBindings()
+	hintText := m.hint(k.NextField, k.Save, k.Cancel)
+	if m.save.confirm {
+		hintText = m.hint(k.Overwrite, k.Keep)
+	}
+	hint := lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Render(hintText)
+
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		"",
+		m.save.filename.View(),
+		m.save.folder.View(),
+		"",
+		status,
+		hint,
+	)
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(primaryColor).
+		Padding(1, 2).
+		Width(min(70, m.width-4)).
+		Render(content)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
+
+// defaultNameTemplate is the template used to name saved images when --name-template is not set
+const defaultNameTemplate = "{{.Date}}_{{.Time}}_{{.Prompt}}"
+
+// saveCounter is the number of images saved during this session
+var saveCounter atomic.Int64
+
+// nameData is the data available to --name-template
+type nameData struct {
+	Prompt  string    // Prompt slug (lowercase, max 50 chars)
+	Model   string    // FLUX model (schnell, pro or dev)
+	Seed    int       // Seed used for the prediction
+	Aspect  string    // Aspect ratio with ':' replaced by 'x' (e.g. 16x9)
+	Format  string    // Output format (png, webp or jpg)
+	ID      string    // Replicate prediction ID
+	Date    string    // Date the image was generated (2006-01-02)
+	Time    string    // Time the image was generated (150405)
+	Now     time.Time // Time the image was generated, for custom layouts
+	Counter int       // Number of this save in the session, starting at 1
+}
+
+// parseNameTemplate parses a filename template
+func parseNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// imageFilename renders the filename template for a generated image, the
+// counter being its number in the session.
+// The template may contain '/' to place images in subfolders of the output folder.
+func imageFilename(text string, g generation, counter int) (string, error) {
+	if text == "" {
+		text = defaultNameTemplate
+	}
+	tmpl, err := parseNameTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	created := g.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nameData{
+		Prompt:  slugify(g.Prompt, 50),
+		Model:   g.Model,
+		Seed:    g.Seed,
+		Aspect:  strings.ReplaceAll(g.AspectRatio, ":", "x"),
+		Format:  g.Format,
+		ID:      g.PredictionID,
+		Date:    created.Format("2006-01-02"),
+		Time:    created.Format("150405"),
+		Now:     created,
+		Counter: counter,
+	}); err != nil {
+		return "", fmt.Errorf("failed to render name template: %w", err)
+	}
+
+	name := filepath.Clean(filepath.FromSlash(strings.TrimSpace(b.String())))
+	if name == "." || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("name template must produce a relative path inside the output folder: %q", name)
+	}
+	if ext := "." + g.Format; !strings.EqualFold(filepath.Ext(name), ext) {
+		name += ext
+	}
+	return name, nil
+}
+
+// slugify turns a prompt into a lowercase filename-safe slug of at most n runes
+func slugify(prompt string, n int) string {
+	var b strings.Builder
+	sep := false
+	count := 0
+	for _, r := range strings.ToLower(prompt) {
+		if count >= n {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			if sep && b.Len() > 0 {
+				b.WriteRune('_')
+				count++
+			}
+			b.WriteRune(r)
+			count++
+			sep = false
+		} else {
+			sep = true
+		}
+	}
+	if b.Len() == 0 {
+		return "image"
+	}
+	return b.String()
+}
+
+// numberedPath returns path with a numeric suffix before the extension
+func numberedPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// uniquePath returns path, or path with a numeric suffix if a file already exists there
+func uniquePath(path string) string {
+	candidate := path
+	for i := 2; fileExists(candidate); i++ {
+		candidate = numberedPath(path, i)
+	}
+	return candidate
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+// saveGeneration saves the image to the output folder using the name template,
+// adding a numeric suffix instead of overwriting an existing file, and records it in the history
+func saveGeneration(g generation, c *config) (string, error) {
+	// Take the number up front so images saved at the same time don't share it
+	name, err := imageFilename(c.NameTemplate, g, int(saveCounter.Add(1)))
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(c.OutputFolder, name)
+	path := target
+	for i := 2; ; i++ {
+		_, err := saveImage(g.Image, path, false)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+		path = numberedPath(target, i)
+	}
+	completePrediction(g.PredictionID)
+	if err := recordHistory(g, path); err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// saveImage saves the generated image to disk, creating any missing parent folders.
+// If the file already exists and overwrite is false an error wrapping fs.ErrExist is returned.
+func saveImage(imageData []byte, filename string, overwrite bool) (string, error) {
+	if dir := filepath.Dir(filename); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("error creating output folder: %w", err)
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(filename, flags, 0644)
+	if err != nil {
+		return "", fmt.Errorf("error saving image: %w", err)
+	}
+	if _, err := f.Write(imageData); err != nil {
+		f.Close()
+		return "", fmt.Errorf("error saving image: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("error saving image: %w", err)
+	}
+	return filename, nil
+}
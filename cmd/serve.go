@@ -0,0 +1,437 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+var (
+	// serve flags
+	serveAddr        string
+	serveToken       string
+	serveConcurrency int
+	serveQueueSize   int
+)
+
+// Finished jobs are kept for polling for jobTTL, and only the latest maxFinishedJobs
+// of them, their images stay in the history
+var (
+	jobTTL          = time.Hour
+	maxFinishedJobs = 1000
+)
+
+// job is an image generation request submitted to the HTTP API
+type job struct {
+	ID           string     `json:"id"`
+	Status       string     `json:"status"`
+	Prompt       string     `json:"prompt"`
+	Style        string     `json:"style,omitempty"`
+	Model        string     `json:"model"`
+	AspectRatio  string     `json:"aspect_ratio"`
+	Format       string     `json:"format"`
+	Seed         int        `json:"seed,omitempty"`
+	PredictionID string     `json:"prediction_id,omitempty"`
+	Path         string     `json:"path,omitempty"`
+	ImageURL     string     `json:"image_url,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+
+	config *config
+}
+
+// server is the fluxy HTTP API
+type server struct {
+	config *config
+	token  string
+
+	mu    sync.Mutex
+	jobs  map[string]*job
+	order []string // job IDs in submission order
+	queue chan *job
+}
+
+func newServer(c *config, token string, concurrency, queueSize int) *server {
+	s := &server{
+		config: c,
+		token:  token,
+		jobs:   make(map[string]*job),
+		queue:  make(chan *job, queueSize),
+	}
+	for range concurrency {
+		go s.worker()
+	}
+	return s
+}
+
+// routes returns the API and gallery handlers behind bearer-token auth
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/generate", s.handleGenerate)
+	mux.HandleFunc("GET /api/jobs", s.handleListJobs)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("GET /api/jobs/{id}/image", s.handleJobImage)
+	mux.HandleFunc("GET /api/history", s.handleHistory)
+	mux.HandleFunc("GET /api/images/{id}", s.handleHistoryImage)
+	mux.HandleFunc("GET /{$}", s.handleGallery)
+	return s.auth(mux)
+}
+
+// auth requires the server token as a bearer token, or as a ?token= query
+// parameter so the gallery can be opened in a browser
+func (s *server) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == r.Header.Get("Authorization") {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="fluxy"`)
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// worker runs queued jobs until the queue is closed
+func (s *server) worker() {
+	for j := range s.queue {
+		s.update(j, func(j *job) {
+			now := time.Now()
+			j.Status = jobRunning
+			j.StartedAt = &now
+		})
+		logger.Info("Generating image", "job", j.ID, "model", j.Model, "prompt", j.Prompt)
+
+		g, err := generate(j.Prompt, j.config)
+		var path string
+		if err == nil {
+			path, err = saveGeneration(g, j.config)
+			if path != "" && err != nil {
+				logger.Warn("Image saved but not added to history", "job", j.ID, "err", err)
+				err = nil
+			}
+		}
+
+		s.update(j, func(j *job) {
+			now := time.Now()
+			j.CompletedAt = &now
+			if err != nil {
+				j.Status = jobFailed
+				j.Error = err.Error()
+				return
+			}
+			j.Status = jobSucceeded
+			j.PredictionID = g.PredictionID
+			j.Seed = g.Seed
+			j.Path = path
+			j.ImageURL = "/api/jobs/" + j.ID + "/image"
+		})
+		if err != nil {
+			logger.Error("Image generation failed", "job", j.ID, "err", err)
+		} else {
+			logger.Info("Image saved", "job", j.ID, "path", path)
+		}
+	}
+}
+
+// update modifies a job while holding the lock
+func (s *server) update(j *job, fn func(*job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(j)
+}
+
+// prune forgets finished jobs that are older than jobTTL or beyond the latest
+// maxFinishedJobs, it's called with the lock held
+func (s *server) prune(now time.Time) {
+	finished := 0
+	for _, id := range s.order {
+		if s.jobs[id].CompletedAt != nil {
+			finished++
+		}
+	}
+	order := s.order[:0]
+	for _, id := range s.order {
+		j := s.jobs[id]
+		if j.CompletedAt != nil && (finished > maxFinishedJobs || now.Sub(*j.CompletedAt) > jobTTL) {
+			finished--
+			delete(s.jobs, id)
+			continue
+		}
+		order = append(order, id)
+	}
+	clear(s.order[len(order):])
+	s.order = order
+}
+
+// snapshot returns a copy of the job that is safe to encode
+func (s *server) snapshot(id string) (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+func (s *server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	var req generateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	c, err := s.config.forRequest(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	j := &job{
+		ID:          newJobID(),
+		Status:      jobQueued,
+		Prompt:      req.Prompt,
+		Style:       styleName(c.Style),
+		Model:       c.FluxModel,
+		AspectRatio: c.AspectRatio,
+		Format:      c.OutputFormat,
+		Seed:        c.Seed,
+		CreatedAt:   time.Now(),
+		config:      c,
+	}
+
+	s.mu.Lock()
+	s.prune(time.Now())
+	select {
+	case s.queue <- j:
+		s.jobs[j.ID] = j
+		s.order = append(s.order, j.ID)
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "job queue is full, try again later")
+		return
+	}
+	snapshot := *j
+	s.mu.Unlock()
+
+	w.Header().Set("Location", "/api/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+func (s *server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	jobs := make([]job, 0, len(s.order))
+	for _, id := range slices.Backward(s.order) {
+		jobs = append(jobs, *s.jobs[id])
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.snapshot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+func (s *server) handleJobImage(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.snapshot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	if j.Status != jobSucceeded {
+		writeError(w, http.StatusConflict, "job has not succeeded (status: "+j.Status+")")
+		return
+	}
+	http.ServeFile(w, r, j.Path)
+}
+
+func (s *server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	entries, err := loadHistory(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []historyEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (s *server) handleHistoryImage(w http.ResponseWriter, r *http.Request) {
+	entries, err := loadHistory(0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	i := slices.IndexFunc(entries, func(e historyEntry) bool { return e.PredictionID == r.PathValue("id") })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "image not found")
+		return
+	}
+	http.ServeFile(w, r, entries[i].Path)
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="15">
+<title>fluxy gallery</title>
+<style>
+body { background: #0f172a; color: #f8fafc; font-family: system-ui, sans-serif; margin: 2rem; }
+h1 { color: #7c3aed; }
+.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(260px, 1fr)); gap: 1rem; }
+figure { background: #1e293b; border: 1px solid #475569; border-radius: 8px; margin: 0; padding: .5rem; }
+img { width: 100%; border-radius: 4px; }
+figcaption { font-size: .85rem; margin-top: .5rem; }
+.meta { color: #64748b; font-size: .75rem; }
+</style>
+</head>
+<body>
+<h1>✨ fluxy</h1>
+{{if not .Entries}}<p class="meta">No images yet.</p>{{end}}
+<div class="grid">
+{{range .Entries}}<figure>
+<a href="/api/images/{{.PredictionID}}?token={{$.Token}}"><img loading="lazy" src="/api/images/{{.PredictionID}}?token={{$.Token}}" alt="{{.Prompt}}"></a>
+<figcaption>{{.Prompt}}<div class="meta">{{.Model}}{{if .Style}} • {{.Style}}{{end}} • {{.AspectRatio}}{{if .Seed}} • seed {{.Seed}}{{end}} • {{.CreatedAt.Format "2006-01-02 15:04"}}</div></figcaption>
+</figure>
+{{end}}</div>
+</body>
+</html>
+`))
+
+func (s *server) handleGallery(w http.ResponseWriter, r *http.Request) {
+	entries, err := loadHistory(200)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	entries = slices.DeleteFunc(entries, func(e historyEntry) bool { return e.PredictionID == "" })
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := galleryTemplate.Execute(w, map[string]any{
+		"Entries": entries,
+		"Token":   r.URL.Query().Get("token"),
+	}); err != nil {
+		logger.Error("Failed to render gallery", "err", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a local HTTP API and web gallery",
+	Long: `Serve a local HTTP API and web gallery.
+
+Endpoints (all require "Authorization: Bearer <token>" or "?token=<token>"):
+  POST /api/generate          submit a job {"prompt", "model", "aspect_ratio", "size", "format", "style", "seed"}
+  GET  /api/jobs              list jobs
+  GET  /api/jobs/{id}         poll a job
+  GET  /api/jobs/{id}/image   fetch a finished job's image
+  GET  /api/history           list saved images (?limit=N)
+  GET  /api/images/{id}       fetch a saved image by prediction ID
+  GET  /                      web gallery`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := loadConfig()
+		if err != nil {
+			logger.Error("Invalid configuration", "err", err)
+			os.Exit(1)
+		}
+		if _, err := replicateToken(c); err != nil && c.Backend != backendMock {
+			logger.Error("Missing Replicate API token", "err", err)
+			os.Exit(1)
+		}
+		if serveConcurrency < 1 || serveQueueSize < 1 {
+			logger.Error("--concurrency and --queue-size must be at least 1")
+			os.Exit(1)
+		}
+
+		token := serveToken
+		if token == "" {
+			token = os.Getenv("FLUXY_SERVE_TOKEN")
+		}
+		if token == "" {
+			token = newJobID() + newJobID()
+			logger.Warn("No --token or FLUXY_SERVE_TOKEN set, generated one for this session", "token", token)
+		}
+
+		s := newServer(c, token, serveConcurrency, serveQueueSize)
+		srv := &http.Server{
+			Addr:              serveAddr,
+			Handler:           s.routes(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdownCtx)
+		}()
+
+		logger.Info("Serving fluxy", "addr", "http://"+serveAddr, "gallery", "http://"+serveAddr+"/?token="+token)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Server failed", "err", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:8420", "Address to listen on")
+	serveCmd.Flags().StringVar(&serveToken, "token", "", "Bearer token clients must send (overrides FLUXY_SERVE_TOKEN env_var)")
+	serveCmd.Flags().IntVarP(&serveConcurrency, "concurrency", "c", 2, "Maximum number of images generated at once")
+	serveCmd.Flags().IntVar(&serveQueueSize, "queue-size", 100, "Maximum number of queued jobs")
+}
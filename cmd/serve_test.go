@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer serves the API with the mock backend, saving into a temporary folder
+func newTestServer(t *testing.T, fail string) *httptest.Server {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	logger.SetOutput(io.Discard)
+	t.Cleanup(func() { logger.SetOutput(os.Stderr) })
+	c := &config{
+		FluxModel:    "schnell",
+		AspectRatio:  "1:1",
+		OutputFormat: "png",
+		OutputFolder: t.TempDir(),
+		NameTemplate: defaultNameTemplate,
+		Safety:       defaultSafety,
+		Backend:      backendMock,
+		Mock:         mockConfig{Fail: fail, FailRate: 1},
+	}
+	srv := httptest.NewServer(newServer(c, "secret", 1, 10).routes())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// call sends an authorized request and decodes the JSON response into v (if set)
+func call(t *testing.T, method, url, body string, v any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: %v", method, url, err)
+		}
+	}
+	return resp
+}
+
+// waitForJob polls the job until it's finished
+func waitForJob(t *testing.T, srv *httptest.Server, id string) job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var j job
+		call(t, "GET", srv.URL+"/api/jobs/"+id, "", &j)
+		if j.Status == jobSucceeded || j.Status == jobFailed {
+			return j
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s", id, j.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServeAuth(t *testing.T) {
+	srv := newTestServer(t, "")
+	for _, tt := range []struct {
+		name, url, auth string
+		want            int
+	}{
+		{"no token", "/api/jobs", "", http.StatusUnauthorized},
+		{"wrong token", "/api/jobs", "Bearer nope", http.StatusUnauthorized},
+		{"not bearer", "/api/jobs", "secret", http.StatusUnauthorized},
+		{"bearer", "/api/jobs", "Bearer secret", http.StatusOK},
+		{"query", "/api/jobs?token=secret", "", http.StatusOK},
+		{"wrong query", "/?token=nope", "", http.StatusUnauthorized},
+	} {
+		req, _ := http.NewRequest("GET", srv.URL+tt.url, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: got %s, want %d", tt.name, resp.Status, tt.want)
+		}
+		if tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate header", tt.name)
+		}
+	}
+}
+
+func TestServeJobs(t *testing.T) {
+	srv := newTestServer(t, "")
+
+	var j job
+	resp := call(t, "POST", srv.URL+"/api/generate", `{"prompt":"a cat","seed":7}`, &j)
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Location") != "/api/jobs/"+j.ID {
+		t.Fatalf("got %s with Location %q", resp.Status, resp.Header.Get("Location"))
+	}
+	if j.Status != jobQueued || j.Prompt != "a cat" || j.Model != "schnell" || j.Seed != 7 {
+		t.Errorf("got job %+v", j)
+	}
+
+	j = waitForJob(t, srv, j.ID)
+	if j.Status != jobSucceeded || j.PredictionID == "" || j.ImageURL != "/api/jobs/"+j.ID+"/image" || j.StartedAt == nil || j.CompletedAt == nil {
+		t.Fatalf("got job %+v", j)
+	}
+	resp = call(t, "GET", srv.URL+j.ImageURL, "", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("image: got %s of %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	var jobs []job
+	call(t, "GET", srv.URL+"/api/jobs", "", &jobs)
+	if len(jobs) != 1 || jobs[0].ID != j.ID {
+		t.Errorf("got jobs %+v", jobs)
+	}
+
+	for _, tt := range []struct {
+		name, method, url, body string
+		want                    int
+	}{
+		{"invalid JSON", "POST", "/api/generate", `{"prompt":`, http.StatusBadRequest},
+		{"no prompt", "POST", "/api/generate", `{"prompt":" "}`, http.StatusBadRequest},
+		{"unknown model", "POST", "/api/generate", `{"prompt":"a cat","model":"nope"}`, http.StatusBadRequest},
+		{"unknown job", "GET", "/api/jobs/nope", "", http.StatusNotFound},
+		{"unknown job image", "GET", "/api/jobs/nope/image", "", http.StatusNotFound},
+	} {
+		if resp := call(t, tt.method, srv.URL+tt.url, tt.body, nil); resp.StatusCode != tt.want {
+			t.Errorf("%s: got %s, want %d", tt.name, resp.Status, tt.want)
+		}
+	}
+}
+
+func TestServeFailedJob(t *testing.T) {
+	srv := newTestServer(t, "422")
+
+	var j job
+	call(t, "POST", srv.URL+"/api/generate", `{"prompt":"a cat"}`, &j)
+	j = waitForJob(t, srv, j.ID)
+	if j.Status != jobFailed || j.Error == "" || j.ImageURL != "" {
+		t.Fatalf("got job %+v", j)
+	}
+	if resp := call(t, "GET", srv.URL+"/api/jobs/"+j.ID+"/image", "", nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("image of a failed job: got %s", resp.Status)
+	}
+}
+
+func TestServeGallery(t *testing.T) {
+	srv := newTestServer(t, "")
+
+	var j job
+	call(t, "POST", srv.URL+"/api/generate", `{"prompt":"a <b>cat</b>"}`, &j)
+	j = waitForJob(t, srv, j.ID)
+
+	var history []historyEntry
+	call(t, "GET", srv.URL+"/api/history?limit=5", "", &history)
+	if len(history) != 1 || history[0].PredictionID != j.PredictionID {
+		t.Fatalf("got history %+v", history)
+	}
+	resp := call(t, "GET", srv.URL+"/api/images/"+j.PredictionID, "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("history image: got %s", resp.Status)
+	}
+	if resp := call(t, "GET", srv.URL+"/api/images/nope", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown history image: got %s", resp.Status)
+	}
+
+	resp, err := http.Get(srv.URL + "/?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	// Images are linked with the token so they load in the browser, prompts are escaped
+	if !bytes.Contains(page, []byte(`src="/api/images/`+j.PredictionID+`?token=secret"`)) || !bytes.Contains(page, []byte("a &lt;b&gt;cat&lt;/b&gt;")) {
+		t.Errorf("got gallery:\n%s", page)
+	}
+}
+
+func TestServePrune(t *testing.T) {
+	ttl, max := jobTTL, maxFinishedJobs
+	jobTTL, maxFinishedJobs = time.Hour, 2
+	t.Cleanup(func() { jobTTL, maxFinishedJobs = ttl, max })
+
+	now := time.Now()
+	s := newServer(&config{}, "secret", 0, 10)
+	add := func(id string, finished time.Duration) {
+		j := &job{ID: id, Status: jobRunning}
+		if finished > 0 {
+			at := now.Add(-finished)
+			j.Status, j.CompletedAt = jobSucceeded, &at
+		}
+		s.jobs[id] = j
+		s.order = append(s.order, id)
+	}
+	add("expired", 2*time.Hour)
+	add("oldest", 30*time.Minute)
+	add("running", 0)
+	add("older", 20*time.Minute)
+	add("newest", 10*time.Minute)
+
+	s.prune(now)
+	if got := strings.Join(s.order, ","); got != "running,older,newest" || len(s.jobs) != 3 {
+		t.Errorf("got jobs %s (%d)", got, len(s.jobs))
+	}
+}
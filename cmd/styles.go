@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/v2/key"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// stylePreset wraps prompts in a house style and can pin the generation settings
+type stylePreset struct {
+	Name        string         `yaml:"name"`
+	Description string         `yaml:"description"`
+	Prefix      string         `yaml:"prefix"`       // text placed before the prompt
+	Suffix      string         `yaml:"suffix"`       // text placed after the prompt
+	Model       string         `yaml:"model"`        // pins the FLUX model
+	AspectRatio string         `yaml:"aspect_ratio"` // pins the aspect ratio
+	Params      map[string]any `yaml:"params"`       // extra model inputs e.g. guidance or num_inference_steps
+}
+
+var builtinStyles = []stylePreset{
+	{
+		Name:        "product-shot",
+		Description: "Product shot on a white background",
+		Prefix:      "Professional studio product photograph of",
+		Suffix:      "centered on a seamless pure white background, soft diffused lighting, subtle shadow, high detail, commercial catalog style",
+		AspectRatio: "1:1",
+	},
+	{
+		Name:        "isometric-pixel-art",
+		Description: "Isometric pixel art",
+		Prefix:      "Isometric pixel art of",
+		Suffix:      "crisp pixels, limited color palette, clean outlines, 16-bit video game style, plain background",
+	},
+	{
+		Name:        "cinematic",
+		Description: "Cinematic film still",
+		Prefix:      "Cinematic film still of",
+		Suffix:      "anamorphic lens, shallow depth of field, dramatic lighting, film grain, color graded",
+		AspectRatio: "21:9",
+	},
+	{
+		Name:        "watercolor",
+		Description: "Loose watercolor illustration",
+		Prefix:      "Watercolor painting of",
+		Suffix:      "loose brush strokes, soft color bleeds, textured paper, light and airy",
+	},
+	{
+		Name:        "line-art",
+		Description: "Minimal black and white line art",
+		Prefix:      "Minimal line art drawing of",
+		Suffix:      "single continuous black line on white, no shading, elegant and simple",
+	},
+}
+
+// styleLibrary returns the built-in styles followed by the user's, where a
+// user style with the same name as a built-in one replaces it
+func styleLibrary(user []stylePreset) []stylePreset {
+	styles := slices.Clone(builtinStyles)
+	for _, s := range user {
+		if i := slices.IndexFunc(styles, func(b stylePreset) bool { return b.Name == s.Name }); i >= 0 {
+			styles[i] = s
+		} else {
+			styles = append(styles, s)
+		}
+	}
+	return styles
+}
+
+// findStyle returns the style with the given name
+func findStyle(styles []stylePreset, name string) (*stylePreset, error) {
+	for _, s := range styles {
+		if s.Name == name {
+			return &s, nil
+		}
+	}
+	names := make([]string, 0, len(styles))
+	for _, s := range styles {
+		names = append(names, s.Name)
+	}
+	return nil, fmt.Errorf("unknown style %q (must be one of: %s)", name, strings.Join(names, ", "))
+}
+
+// styleName returns the name of the style or "" if none is selected
+func styleName(s *stylePreset) string {
+	if s == nil {
+		return ""
+	}
+	return s.Name
+}
+
+// validate checks the settings a style pins
+func (s stylePreset) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("style is missing a name")
+	}
+	if s.Model != "" {
+		spec, err := findModel(s.Model)
+		if err != nil {
+			return fmt.Errorf("style %s: %w", s.Name, err)
+		}
+		if s.AspectRatio != "" {
+			if err := spec.checkAspect(s.AspectRatio); err != nil {
+				return fmt.Errorf("style %s: %w", s.Name, err)
+			}
+		}
+	} else if s.AspectRatio != "" {
+		if err := checkAnyAspect(s.AspectRatio); err != nil {
+			return fmt.Errorf("style %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// apply wraps the prompt with the style's prefix and suffix, the prefix leads
+// into the prompt (e.g. "Watercolor painting of") while the suffix is a list
+// of modifiers after it
+func (s stylePreset) apply(prompt string) string {
+	prompt = strings.TrimSpace(prompt)
+	if p := strings.TrimSpace(s.Prefix); p != "" {
+		prompt = p + " " + prompt
+	}
+	if p := strings.TrimSpace(s.Suffix); p != "" {
+		prompt += ", " + p
+	}
+	return prompt
+}
+
+// styled returns the prompt and config to generate with once the selected style is applied
+func (c *config) styled(prompt string) (string, *config) {
+	if c.Style == nil {
+		return prompt, c
+	}
+	sc := *c
+	if c.Style.Model != "" {
+		sc.FluxModel = c.Style.Model
+	}
+	if c.Style.AspectRatio != "" {
+		sc.AspectRatio = c.Style.AspectRatio
+		sc.Size = ""
+	}
+	sc.Params = maps.Clone(c.Params)
+	if sc.Params == nil {
+		sc.Params = make(map[string]any)
+	}
+	maps.Copy(sc.Params, c.Style.Params)
+	return c.Style.apply(prompt), &sc
+}
+
+// withParams merges extra model parameters into the prediction input
+func withParams(input Input, params map[string]any) (any, error) {
+	if len(params) == 0 {
+		return input, nil
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling JSON: %w", err)
+	}
+	merged := make(map[string]any)
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, fmt.Errorf("error unmarshaling JSON: %w", err)
+	}
+	maps.Copy(merged, params)
+	return merged, nil
+}
+
+// openStylePicker shows the style picker with the current style selected
+func (m newModel) openStylePicker() (newModel, tea.Cmd) {
+	m.pickingStyle = true
+	m.styleCursor = 0 // "none"
+	if m.config.Style != nil {
+		if i := slices.IndexFunc(m.config.Styles, func(s stylePreset) bool { return s.Name == m.config.Style.Name }); i >= 0 {
+			m.styleCursor = i + 1
+		}
+	}
+	m.textInput.Blur()
+	return m, nil
+}
+
+// updateStylePicker handles key presses while the style picker is open
+func (m newModel) updateStylePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		m.styleCursor = (m.styleCursor + len(m.config.Styles)) % (len(m.config.Styles) + 1)
+	case key.Matches(msg, m.keys.Down):
+		m.styleCursor = (m.styleCursor + 1) % (len(m.config.Styles) + 1)
+	case key.Matches(msg, m.keys.Select):
+		if m.styleCursor == 0 {
+			m.config.Style = nil
+		} else {
+			style := m.config.Styles[m.styleCursor-1]
+			m.config.Style = &style
+		}
+		fallthrough
+	case key.Matches(msg, m.keys.Back):
+		m.pickingStyle = false
+		return m, m.textInput.Focus()
+	}
+	return m, nil
+}
+
+func (m newModel) stylePickerView() string {
+	title := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(primaryColor).
+		Render("🎨 Style Presets")
+
+	names := []string{"none"}
+	descriptions := []string{"Use the prompt as typed"}
+	for _, s := range m.config.Styles {
+		names = append(names, s.Name)
+		descriptions = append(descriptions, s.Description)
+	}
+	nameWidth := 0
+	for _, n := range names {
+		nameWidth = max(nameWidth, lipgloss.Width(n))
+	}
+
+	rows := make([]string, 0, len(names))
+	for i, name := range names {
+		row := fmt.Sprintf("%-*s  %s", nameWidth, name, descriptions[i])
+		if i == m.styleCursor {
+			rows = append(rows, highlight(accentColor).
+				Render("▸ "+row))
+		} else {
+			rows = append(rows, lipgloss.NewStyle().
+				Foreground(textColor).
+				Render("  "+row))
+		}
+	}
+
+	var details string
+	if m.styleCursor > 0 {
+		s := m.config.Styles[m.styleCursor-1]
+		var pins []string
+		if s.Model != "" {
+			pins = append(pins, "model: "+s.Model)
+		}
+		if s.AspectRatio != "" {
+			pins = append(pins, "aspect: "+s.AspectRatio)
+		}
+		for _, k := range slices.Sorted(maps.Keys(s.Params)) {
+			pins = append(pins, fmt.Sprintf("%s: %v", k, s.Params[k]))
+		}
+		details = lipgloss.NewStyle().
+			Foreground(mutedColor).
+			Width(min(70, m.width-8)).
+			Render(s.apply("<prompt>") + "\n" + strings.Join(pins, " • "))
+	}
+
+	hint := lipgloss.NewStyle().
+		Foreground(mutedColor).
+		Render(m.hint(m.keys.Up, m.keys.Down, m.keys.Select, m.keys.Back))
+
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		"",
+		strings.Join(rows, "\n"),
+		"",
+		details,
+		"",
+		hint,
+	)
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(primaryColor).
+		Padding(1, 2).
+		Render(content)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// theme is a TUI color palette, colors are hex (#RRGGBB) or ANSI 256 color numbers
+type theme struct {
+	Name     string `yaml:"name"`
+	Base     string `yaml:"base"` // built-in theme unset colors come from (default: dark)
+	Primary  string `yaml:"primary"`
+	Accent   string `yaml:"accent"`
+	Success  string `yaml:"success"`
+	Warning  string `yaml:"warning"`
+	Error    string `yaml:"error"`
+	Text     string `yaml:"text"`
+	Muted    string `yaml:"muted"`
+	Border   string `yaml:"border"`
+	Title    string `yaml:"title"`    // text on the primary color
+	Selected string `yaml:"selected"` // text on highlighted items
+}
+
+// themeAuto picks the dark or light theme from the terminal's background
+const themeAuto = "auto"
+
+var builtinThemes = []theme{
+	{
+		Name:     "dark",
+		Primary:  "#7C3AED",
+		Accent:   "#06B6D4",
+		Success:  "#10B981",
+		Warning:  "#F59E0B",
+		Error:    "#EF4444",
+		Text:     "#F8FAFC",
+		Muted:    "#64748B",
+		Border:   "#475569",
+		Title:    "#F8FAFC",
+		Selected: "#000000",
+	},
+	{
+		Name:     "light",
+		Primary:  "#6D28D9",
+		Accent:   "#0E7490",
+		Success:  "#047857",
+		Warning:  "#B45309",
+		Error:    "#B91C1C",
+		Text:     "#0F172A",
+		Muted:    "#64748B",
+		Border:   "#CBD5E1",
+		Title:    "#FFFFFF",
+		Selected: "#FFFFFF",
+	},
+	{
+		Name:     "high-contrast",
+		Primary:  "#FF00FF",
+		Accent:   "#00FFFF",
+		Success:  "#00FF00",
+		Warning:  "#FFFF00",
+		Error:    "#FF0000",
+		Text:     "#FFFFFF",
+		Muted:    "#C0C0C0",
+		Border:   "#FFFFFF",
+		Title:    "#000000",
+		Selected: "#000000",
+	},
+}
+
+// Color palette, set from the theme by applyTheme
+var (
+	primaryColor  color.Color
+	accentColor   color.Color
+	successColor  color.Color
+	warningColor  color.Color
+	errorColor    color.Color
+	textColor     color.Color
+	mutedColor    color.Color
+	borderColor   color.Color
+	titleColor    color.Color
+	selectedColor color.Color
+	noColor       bool // NO_COLOR is set, highlights are shown reversed
+)
+
+func init() {
+	applyTheme(builtinThemes[0])
+}
+
+var themeColorRe = regexp.MustCompile(`^(#[0-9a-fA-F]{6}|#[0-9a-fA-F]{3}|[0-9]{1,3})$`)
+
+// themeLibrary returns the built-in themes followed by the user's, a user
+// theme with the same name as a built-in one replaces it
+func themeLibrary(user []theme) []theme {
+	themes := slices.Clone(builtinThemes)
+	for _, t := range user {
+		if i := slices.IndexFunc(themes, func(b theme) bool { return b.Name == t.Name }); i >= 0 {
+			themes[i] = t
+		} else {
+			themes = append(themes, t)
+		}
+	}
+	return themes
+}
+
+// findTheme returns the theme with the given name, with unset colors filled in from its base
+func findTheme(themes []theme, name string) (*theme, error) {
+	for _, t := range themes {
+		if t.Name != name {
+			continue
+		}
+		base := builtinThemes[0]
+		if t.Base != "" {
+			i := slices.IndexFunc(builtinThemes, func(b theme) bool { return b.Name == t.Base })
+			if i < 0 {
+				return nil, fmt.Errorf("theme %s: unknown base theme %q (must be one of: dark, light, high-contrast)", t.Name, t.Base)
+			}
+			base = builtinThemes[i]
+		}
+		t.fill(base)
+		if err := t.validate(); err != nil {
+			return nil, err
+		}
+		return &t, nil
+	}
+	names := []string{themeAuto}
+	for _, t := range themes {
+		names = append(names, t.Name)
+	}
+	return nil, fmt.Errorf("unknown theme %q (must be one of: %s)", name, strings.Join(names, ", "))
+}
+
+// colors returns pointers to the theme's colors by name
+func (t *theme) colors() map[string]*string {
+	return map[string]*string{
+		"primary":  &t.Primary,
+		"accent":   &t.Accent,
+		"success":  &t.Success,
+		"warning":  &t.Warning,
+		"error":    &t.Error,
+		"text":     &t.Text,
+		"muted":    &t.Muted,
+		"border":   &t.Border,
+		"title":    &t.Title,
+		"selected": &t.Selected,
+	}
+}
+
+func (t *theme) fill(base theme) {
+	from := base.colors()
+	for name, c := range t.colors() {
+		if *c == "" {
+			*c = *from[name]
+		}
+	}
+}
+
+func (t *theme) validate() error {
+	for name, c := range t.colors() {
+		if !themeColorRe.MatchString(*c) {
+			return fmt.Errorf("theme %s: invalid %s color %q (must be #RRGGBB or an ANSI color number)", t.Name, name, *c)
+		}
+	}
+	return nil
+}
+
+// applyTheme sets the color palette from the theme
+func applyTheme(t theme) {
+	primaryColor = lipgloss.Color(t.Primary)
+	accentColor = lipgloss.Color(t.Accent)
+	successColor = lipgloss.Color(t.Success)
+	warningColor = lipgloss.Color(t.Warning)
+	errorColor = lipgloss.Color(t.Error)
+	textColor = lipgloss.Color(t.Text)
+	mutedColor = lipgloss.Color(t.Muted)
+	borderColor = lipgloss.Color(t.Border)
+	titleColor = lipgloss.Color(t.Title)
+	selectedColor = lipgloss.Color(t.Selected)
+	noColor = false
+}
+
+// applyNoColor drops all colors from the palette
+func applyNoColor() {
+	for _, c := range []*color.Color{
+		&primaryColor, &accentColor, &successColor, &warningColor, &errorColor,
+		&textColor, &mutedColor, &borderColor, &titleColor, &selectedColor,
+	} {
+		*c = lipgloss.NoColor{}
+	}
+	noColor = true
+}
+
+// useTheme sets up the palette for the TUI: NO_COLOR wins, then the
+// configured theme, otherwise dark or light depending on the terminal
+func useTheme(c *config) {
+	switch {
+	case os.Getenv("NO_COLOR") != "":
+		applyNoColor()
+	case c.Theme != nil:
+		applyTheme(*c.Theme)
+	case lipgloss.HasDarkBackground(os.Stdin, os.Stdout):
+		applyTheme(builtinThemes[0])
+	default:
+		applyTheme(builtinThemes[1])
+	}
+}
+
+// highlight returns the style of a highlighted item on the color, reversed without colors
+func highlight(c color.Color) lipgloss.Style {
+	if noColor {
+		return lipgloss.NewStyle().Reverse(true)
+	}
+	return lipgloss.NewStyle().Background(c).Foreground(selectedColor)
+}
@@ -0,0 +1,1059 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blacktop/fluxy/replicatetest"
+	"github.com/charmbracelet/bubbles/v2/spinner"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// tuiHarness drives newModel like a tea.Program does: messages go through
+// Update and the commands it returns run in the background, with the
+// messages they produce fed back into Update until the model settles
+type tuiHarness struct {
+	t       *testing.T
+	m       newModel
+	results chan tea.Msg
+	quit    bool
+}
+
+// quietPeriod is how long the model has to go without messages to have settled
+const quietPeriod = 50 * time.Millisecond
+
+func newTUIHarness(t *testing.T, c *config) *tuiHarness {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	clear, render, decoded := clearImages, renderImage, renderDecoded
+	clearImages = func() {}
+	renderImage = func(data []byte, maxW, maxH int) (string, int, int, error) {
+		return fakeImage("image", maxW, maxH)
+	}
+	renderDecoded = func(img image.Image, maxW, maxH int) (string, int, int, error) {
+		return fakeImage(fmt.Sprintf("crop %dx%d", img.Bounds().Dx(), img.Bounds().Dy()), maxW, maxH)
+	}
+	t.Cleanup(func() { clearImages, renderImage, renderDecoded = clear, render, decoded })
+
+	h := &tuiHarness{t: t, m: newInitialModel(c), results: make(chan tea.Msg, 64)}
+	h.run(h.m.Init())
+	h.send(tea.WindowSizeMsg{Width: 100, Height: 30})
+	return h
+}
+
+// fakeImage is a block of characters labeled with what's drawn, like half-block rendering
+func fakeImage(label string, maxW, maxH int) (string, int, int, error) {
+	w, h := min(maxW, 40), min(maxH, 10)
+	lines := []string{fmt.Sprintf("%-*s", w, fmt.Sprintf("<%s %dx%d>", label, w, h))}
+	for range h - 1 {
+		lines = append(lines, strings.Repeat("░", w))
+	}
+	return strings.Join(lines, "\n"), w, h, nil
+}
+
+// run runs the command in the background, splitting up batches
+func (h *tuiHarness) run(cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+	go func() {
+		msg := cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for _, cmd := range batch {
+				h.run(cmd)
+			}
+			return
+		}
+		if msg != nil {
+			h.results <- msg
+		}
+	}()
+}
+
+// ignored returns whether the message is an animation or timer that would keep the model busy forever
+func ignored(msg tea.Msg) bool {
+	switch msg.(type) {
+	case spinner.TickMsg, clearToastMsg:
+		return true
+	}
+	return strings.HasPrefix(fmt.Sprintf("%T", msg), "cursor.")
+}
+
+// send updates the model with the message and waits for it to settle
+func (h *tuiHarness) send(msgs ...tea.Msg) {
+	h.t.Helper()
+	for _, msg := range msgs {
+		h.update(msg)
+	}
+	h.settle()
+}
+
+func (h *tuiHarness) update(msg tea.Msg) {
+	if _, ok := msg.(tea.QuitMsg); ok {
+		h.quit = true
+		return
+	}
+	m, cmd := h.m.Update(msg)
+	h.m = m.(newModel)
+	h.run(cmd)
+}
+
+func (h *tuiHarness) settle() {
+	for {
+		select {
+		case msg := <-h.results:
+			if !ignored(msg) {
+				h.update(msg)
+			}
+		case <-time.After(quietPeriod):
+			return
+		}
+	}
+}
+
+// press sends key presses, e.g. "enter", "ctrl+l" or "a"
+func (h *tuiHarness) press(keys ...string) {
+	h.t.Helper()
+	msgs := make([]tea.Msg, 0, len(keys))
+	for _, k := range keys {
+		msgs = append(msgs, keyPress(k))
+	}
+	h.send(msgs...)
+}
+
+// typeText types the text one key at a time
+func (h *tuiHarness) typeText(text string) {
+	h.t.Helper()
+	var msgs []tea.Msg
+	for _, r := range text {
+		msgs = append(msgs, tea.KeyPressMsg{Code: r, Text: string(r)})
+	}
+	h.send(msgs...)
+}
+
+func keyPress(k string) tea.KeyPressMsg {
+	switch k {
+	case "enter":
+		return tea.KeyPressMsg{Code: tea.KeyEnter}
+	case "esc":
+		return tea.KeyPressMsg{Code: tea.KeyEscape}
+	case "tab":
+		return tea.KeyPressMsg{Code: tea.KeyTab}
+	case "up":
+		return tea.KeyPressMsg{Code: tea.KeyUp}
+	case "down":
+		return tea.KeyPressMsg{Code: tea.KeyDown}
+	case "left":
+		return tea.KeyPressMsg{Code: tea.KeyLeft}
+	case "right":
+		return tea.KeyPressMsg{Code: tea.KeyRight}
+	case "f1":
+		return tea.KeyPressMsg{Code: tea.KeyF1}
+	}
+	if ctrl, ok := strings.CutPrefix(k, "ctrl+"); ok {
+		return tea.KeyPressMsg{Code: rune(ctrl[0]), Mod: tea.ModCtrl}
+	}
+	return tea.KeyPressMsg{Code: rune(k[0]), Text: k}
+}
+
+// view returns the model's view without styling
+func (h *tuiHarness) view() string {
+	return plain(h.m.View())
+}
+
+func plain(s string) string {
+	lines := strings.Split(ansi.Strip(s), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n"
+}
+
+// assertGolden compares got with testdata/tui/<name>.golden, go test -update rewrites it
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "tui", name+".golden")
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s doesn't match the golden file:\n--- got\n%s\n--- want\n%s", name, got, want)
+	}
+}
+
+// fakeGenerator stands in for Replicate, holding generations until released
+type fakeGenerator struct {
+	mu      sync.Mutex
+	prompts []string
+	hold    chan struct{}
+}
+
+// useFakeGenerator makes queued jobs use a fake generator, prompts containing
+// "fail" fail unless generated with dev, "throttle" ones are rate limited and
+// "nsfw" ones are blocked unless safety is relaxed all the way
+func useFakeGenerator(t *testing.T, hold bool) *fakeGenerator {
+	f := &fakeGenerator{}
+	if hold {
+		f.hold = make(chan struct{})
+	}
+	generate := generateFunc
+	generateFunc = f.generate
+	t.Cleanup(func() { generateFunc = generate })
+	return f
+}
+
+func (f *fakeGenerator) generate(prompt string, c *config, progress func(Response)) (generation, error) {
+	f.mu.Lock()
+	f.prompts = append(f.prompts, prompt)
+	f.mu.Unlock()
+
+	progress(Response{ID: "fake-" + prompt, Status: "starting"})
+	progress(Response{ID: "fake-" + prompt, Status: "processing"})
+	if f.hold != nil {
+		<-f.hold
+	}
+	if strings.Contains(prompt, "login") {
+		if _, err := replicateToken(c); err != nil {
+			return generation{}, err
+		}
+	}
+	if s := c.safety(); strings.Contains(prompt, "nsfw") && s.relaxed(c.FluxModel, 1) != s {
+		return generation{}, &safetyError{Prompt: prompt, Model: c.FluxModel, Settings: s, Reason: "NSFW content detected."}
+	}
+	if strings.Contains(prompt, "black") {
+		g := generation{Image: []byte("image of " + prompt), PredictionID: "fake-" + prompt, Prompt: prompt, Model: c.FluxModel}
+		return generation{}, &safetyError{Prompt: prompt, Model: c.FluxModel, Settings: c.safety(), Reason: "the image came back blank", Blank: &g}
+	}
+	if strings.Contains(prompt, "throttle") {
+		return generation{}, &generationError{Kind: kindRateLimit, Err: errors.New("replicate API error: 429 Too Many Requests")}
+	}
+	if strings.Contains(prompt, "fail") && c.FluxModel != "dev" {
+		return generation{}, &generationError{Kind: kindFailed, Err: errors.New("image generation failed: CUDA out of memory")}
+	}
+	return generation{
+		Image:        []byte("image of " + prompt),
+		PredictionID: "fake-" + prompt,
+		Prompt:       prompt,
+		Model:        c.FluxModel,
+		Seed:         42,
+		AspectRatio:  c.AspectRatio,
+		Format:       c.OutputFormat,
+		CreatedAt:    time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}, nil
+}
+
+// release lets held generations finish
+func (f *fakeGenerator) release() {
+	close(f.hold)
+}
+
+func (f *fakeGenerator) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.prompts)
+}
+
+func tuiConfig() *config {
+	return &config{
+		FluxModel:    "pro",
+		AspectRatio:  "1:1",
+		OutputFormat: "png",
+		NameTemplate: defaultNameTemplate,
+		Styles:       styleLibrary(nil),
+		Concurrency:  2,
+	}
+}
+
+func TestTUIInput(t *testing.T) {
+	h := newTUIHarness(t, tuiConfig())
+	if !h.m.inputMode || h.m.generating {
+		t.Fatal("expected to start in the prompt input")
+	}
+	h.typeText("a cat in a hat")
+	if got := h.m.textInput.Value(); got != "a cat in a hat" {
+		t.Errorf("got input %q", got)
+	}
+	assertGolden(t, "input", h.view())
+
+	// An empty prompt isn't generated
+	h = newTUIHarness(t, tuiConfig())
+	h.press("enter")
+	if !h.m.inputMode || len(h.m.jobs) != 0 {
+		t.Error("empty prompt was submitted")
+	}
+}
+
+func TestTUIGenerate(t *testing.T) {
+	gen := useFakeGenerator(t, true)
+	h := newTUIHarness(t, tuiConfig())
+
+	h.typeText("a cat")
+	h.press("enter")
+	if h.m.inputMode || !h.m.generating {
+		t.Fatal("expected the loading view after submitting a prompt")
+	}
+	if got := h.m.jobs[0].status; got != "processing" {
+		t.Errorf("got job status %q, want processing", got)
+	}
+	assertGolden(t, "loading", h.view())
+
+	gen.release()
+	h.settle()
+	if h.m.generating || string(h.m.imageData) != "image of a cat" || h.m.result.Prompt != "a cat" {
+		t.Fatalf("expected the image view, got generating=%v image=%q", h.m.generating, h.m.imageData)
+	}
+	if h.m.jobs[0].status != jobSucceeded {
+		t.Errorf("got job status %q", h.m.jobs[0].status)
+	}
+	assertGolden(t, "image", h.view())
+}
+
+func TestTUIPromptFlag(t *testing.T) {
+	useFakeGenerator(t, false)
+	c := tuiConfig()
+	c.Prompt = "a dog"
+	h := newTUIHarness(t, c)
+	if string(h.m.imageData) != "image of a dog" {
+		t.Errorf("--prompt wasn't generated on start, got image %q", h.m.imageData)
+	}
+}
+
+func TestTUIError(t *testing.T) {
+	useFakeGenerator(t, false)
+	h := newTUIHarness(t, tuiConfig())
+
+	h.typeText("fail please")
+	h.press("enter")
+	if h.m.err == nil || h.m.generating {
+		t.Fatal("expected the error view")
+	}
+	if h.m.jobs[0].status != jobFailed {
+		t.Errorf("got job status %q", h.m.jobs[0].status)
+	}
+	assertGolden(t, "error", h.view())
+}
+
+func TestTUIErrorActions(t *testing.T) {
+	useFakeGenerator(t, false)
+	h := newTUIHarness(t, tuiConfig())
+	h.typeText("fail please")
+	h.press("enter")
+
+	// The models that can't run with the config are skipped
+	var offered []string
+	for range 4 {
+		h.press("tab")
+		offered = append(offered, h.m.errModel)
+	}
+	if got := strings.Join(offered, ","); got != "dev,pro-1.1,schnell,pro" {
+		t.Errorf("got models %s offered, want the ones without LoRAs", got)
+	}
+
+	// Retry with another model
+	h.press("tab", "tab", "shift+tab")
+	if h.m.errModel != "dev" {
+		t.Fatalf("got model %q offered, want dev", h.m.errModel)
+	}
+	h.press("enter")
+	if h.m.err != nil || string(h.m.imageData) != "image of fail please" || h.m.config.FluxModel != "dev" {
+		t.Fatalf("expected the retry with dev to succeed, got err %v", h.m.err)
+	}
+
+	// Rate limits can't be fixed with another model
+	h.press("n")
+	h.typeText("throttle me")
+	h.press("enter")
+	if kind := errorKindOf(h.m.err); kind != kindRateLimit {
+		t.Fatalf("got a %q error", kind)
+	}
+	view := h.view()
+	if strings.Contains(view, "Model") || !strings.Contains(view, "Rate limited") {
+		t.Errorf("rate limit view offers the wrong actions:\n%s", view)
+	}
+	if details := h.m.errorDetails(); !strings.Contains(details, "Kind: rate limit") || !strings.Contains(details, "Prompt: throttle me") {
+		t.Errorf("got details %q", details)
+	}
+
+	// The prompt can be edited, or the error dismissed to get back to the last image
+	h.press("n")
+	if h.m.err != nil || !h.m.inputMode || h.m.textInput.Value() != "throttle me" {
+		t.Fatalf("expected to edit the prompt, got err %v input %q", h.m.err, h.m.textInput.Value())
+	}
+	h.press("enter")
+	h.press("esc")
+	if h.m.err != nil || h.m.inputMode || string(h.m.imageData) != "image of fail please" {
+		t.Fatalf("expected the last image after dismissing, got err %v input mode %v", h.m.err, h.m.inputMode)
+	}
+}
+
+func TestTUIControls(t *testing.T) {
+	gen := useFakeGenerator(t, false)
+	h := newTUIHarness(t, tuiConfig())
+	h.typeText("a cat")
+	h.press("enter")
+
+	h.press("right")
+	if h.m.selectedBtn != 1 {
+		t.Errorf("right: got button %d", h.m.selectedBtn)
+	}
+	h.press("tab")
+	if h.m.selectedBtn != 0 {
+		t.Errorf("tab: got button %d", h.m.selectedBtn)
+	}
+
+	// Enter on Download opens the save dialog, Esc closes it
+	h.press("l", "enter")
+	if !h.m.saving {
+		t.Fatal("expected the save dialog")
+	}
+	h.press("f1")
+	if screen, _ := h.m.helpScreen(); !h.m.showingHelp || screen != "Save" {
+		t.Fatalf("expected the save dialog's help, got %q", screen)
+	}
+	h.press("esc", "esc")
+	if h.m.saving {
+		t.Fatal("expected the save dialog to close")
+	}
+
+	// Enter on Regenerate queues the prompt again
+	h.press("h", "enter")
+	if len(h.m.jobs) != 2 || gen.calls() != 2 || string(h.m.imageData) != "image of a cat" {
+		t.Errorf("regenerate: got %d jobs and %d generations", len(h.m.jobs), gen.calls())
+	}
+}
+
+func TestTUICopyImage(t *testing.T) {
+	useFakeGenerator(t, false)
+	t.Setenv("SSH_TTY", "/dev/pts/0")
+	t.Setenv("TMUX", "")
+	h := newTUIHarness(t, tuiConfig())
+	h.typeText("a cat")
+	h.press("enter")
+
+	// The image is converted in the background, failures come back as a toast
+	h.press("c")
+	if !strings.Contains(h.m.toast, "Failed to copy image") {
+		t.Fatalf("got toast %q", h.m.toast)
+	}
+	h.m.imageData = replicatetest.Image()
+	h.press("c")
+	if !strings.Contains(h.m.toast, "Copied image to clipboard (OSC 52)") {
+		t.Errorf("got toast %q", h.m.toast)
+	}
+}
+
+func TestTUIMouse(t *testing.T) {
+	gen := useFakeGenerator(t, false)
+	h := newTUIHarness(t, tuiConfig())
+	h.typeText("a cat")
+	h.press("enter")
+
+	for _, size := range []tea.WindowSizeMsg{{Width: 100, Height: 30}, {Width: 36, Height: 20}, {Width: 160, Height: 50}} {
+		h.send(size)
+		l := h.m.layout()
+		download, regenerate := l.Buttons[1], l.Buttons[0]
+
+		// Clicks next to the buttons are ignored
+		h.send(tea.MouseClickMsg{X: download.X + download.W, Y: download.Y, Button: tea.MouseLeft})
+		h.send(tea.MouseClickMsg{X: regenerate.X, Y: regenerate.Y - 1, Button: tea.MouseLeft})
+		if h.m.saving || h.m.selectedBtn != 0 {
+			t.Fatalf("%dx%d: click next to the buttons did something", size.Width, size.Height)
+		}
+
+		h.send(tea.MouseClickMsg{X: download.X + download.W - 1, Y: download.Y, Button: tea.MouseLeft})
+		if !h.m.saving || h.m.selectedBtn != 1 {
+			t.Fatalf("%dx%d: expected clicking Download to open the save dialog", size.Width, size.Height)
+		}
+		h.press("esc")
+
+		calls := gen.calls()
+		h.send(tea.MouseClickMsg{X: regenerate.X, Y: regenerate.Y, Button: tea.MouseLeft})
+		if h.m.selectedBtn != 0 || gen.calls() != calls+1 {
+			t.Errorf("%dx%d: expected clicking Regenerate to generate again", size.Width, size.Height)
+		}
+	}
+}
+
+func TestTUILayout(t *testing.T) {
+	useFakeGenerator(t, false)
+	c := tuiConfig()
+	c.Prompt = "a cat"
+	h := newTUIHarness(t, c)
+
+	l := h.m.layout()
+	if l.Sidebar.W == 0 || l.Image.X+l.Image.W > l.Sidebar.X {
+		t.Errorf("expected the sidebar next to the image at 100 columns: %+v", l)
+	}
+	h.press("i")
+	if l := h.m.layout(); l.Sidebar.W != 0 || l.Image.W != h.m.width-4 {
+		t.Errorf("expected i to collapse the sidebar: %+v", l)
+	}
+	h.press("i")
+
+	h.send(tea.WindowSizeMsg{Width: 36, Height: 20})
+	l = h.m.layout()
+	if l.Sidebar.W != 0 {
+		t.Error("sidebar wasn't collapsed in a narrow terminal")
+	}
+	if l.Buttons[0].X != l.Buttons[1].X || l.Buttons[0].Y >= l.Buttons[1].Y {
+		t.Errorf("buttons weren't stacked in a narrow terminal: %+v", l.Buttons)
+	}
+	if len(l.hint) != maxHintLines || l.Hint.Y+l.Hint.H != l.Toast.Y {
+		t.Errorf("got hint %q at %+v", l.hint, l.Hint)
+	}
+	for _, line := range l.hint {
+		if w := ansi.StringWidth(line); w > l.Hint.W {
+			t.Errorf("hint line is %d cells wide, wider than %d", w, l.Hint.W)
+		}
+	}
+	assertGolden(t, "image-narrow", h.view())
+}
+
+func TestTUIZoom(t *testing.T) {
+	useFakeGenerator(t, false)
+	c := tuiConfig()
+	c.Prompt = "a cat"
+	h := newTUIHarness(t, c)
+
+	h.press("z")
+	if h.m.zooming || !strings.Contains(h.m.toast, "Failed to decode image") {
+		t.Fatalf("expected a toast for an image that can't be decoded, got zooming=%v toast=%q", h.m.zooming, h.m.toast)
+	}
+
+	data, err := encodeImage(mockImage(400, 200, 1), "png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.m.imageData, h.m.toast = data, ""
+	full := image.Rect(0, 0, 400, 200)
+	h.press("z")
+	if !h.m.zooming || h.m.zoom.viewport() != full {
+		t.Fatalf("expected the zoom viewer to open on the whole image, got zooming=%v viewport=%v", h.m.zooming, h.m.zoom.viewport())
+	}
+	if l := h.m.layout(); l.Buttons != [controlButtons]rect{} || l.Sidebar.W != minimapWidth+2 {
+		t.Errorf("expected the minimap in place of the sidebar and no buttons: %+v", l)
+	}
+
+	h.press("+", "+")
+	if v := h.m.zoom.viewport(); v.Dx() != 177 || v.Dy() != 88 || v.Min != image.Pt(112, 56) {
+		t.Errorf("expected zooming in to keep the center, got %v", v)
+	}
+	h.press("right", "right", "right", "right", "right", "down", "down", "down", "down", "down")
+	if v := h.m.zoom.viewport(); v.Max != full.Max {
+		t.Errorf("expected panning to stop at the edge of the image, got %v", v)
+	}
+	assertGolden(t, "zoom", h.view())
+
+	// Dragging to the left shows more of the right, which is as far as it goes
+	l := h.m.layout()
+	before := h.m.zoom.viewport()
+	h.send(
+		tea.MouseClickMsg{X: l.Image.X + 10, Y: l.Image.Y + 5, Button: tea.MouseLeft},
+		tea.MouseMotionMsg{X: l.Image.X + 20, Y: l.Image.Y + 5, Button: tea.MouseLeft},
+		tea.MouseReleaseMsg{X: l.Image.X + 20, Y: l.Image.Y + 5, Button: tea.MouseLeft},
+	)
+	if v := h.m.zoom.viewport(); v.Min.X >= before.Min.X || v.Min.Y != before.Min.Y || h.m.zoom.dragging {
+		t.Errorf("expected dragging right to pan left, got %v from %v", v, before)
+	}
+	h.send(tea.MouseMotionMsg{X: l.Image.X, Y: l.Image.Y, Button: tea.MouseLeft})
+	if v := h.m.zoom.viewport(); v.Min.X >= before.Min.X {
+		t.Errorf("mouse moves after the release panned to %v", v)
+	}
+
+	level := h.m.zoom.level
+	h.send(tea.MouseWheelMsg{X: l.Image.X, Y: l.Image.Y, Button: tea.MouseWheelUp})
+	if h.m.zoom.level <= level {
+		t.Errorf("expected the wheel to zoom in from %v, got %v", level, h.m.zoom.level)
+	}
+
+	h.press("0")
+	if v := h.m.zoom.viewport(); v != full {
+		t.Errorf("expected 0 to fit the whole image, got %v", v)
+	}
+	h.press("-")
+	if h.m.zoom.level != 1 {
+		t.Errorf("zoomed out past fitting the image: %v", h.m.zoom.level)
+	}
+
+	h.press("esc")
+	if h.m.zooming || h.m.layout().Buttons[0].W == 0 {
+		t.Error("expected esc to go back to the image view")
+	}
+}
+
+func TestTUITokenPrompt(t *testing.T) {
+	newFakeReplicate(t)
+	useFakeGenerator(t, false)
+	noToken(t)
+	h := newTUIHarness(t, tuiConfig())
+	h.typeText("login please")
+	h.press("enter")
+	if !h.m.needsToken() {
+		t.Fatalf("expected the error view to ask for a token, got err %v", h.m.err)
+	}
+	assertGolden(t, "token", h.view())
+
+	// Keys like q type into the token
+	h.typeText("q?wrong")
+	h.press("enter")
+	if h.quit || h.m.showingHelp || !errors.Is(h.m.tokenErr, errBadToken) || !h.m.needsToken() {
+		t.Fatalf("expected the token to be rejected, got quit=%v tokenErr=%v", h.quit, h.m.tokenErr)
+	}
+
+	h.typeText("test-token")
+	h.press("enter")
+	if h.m.err != nil || h.m.imageData == nil || h.m.config.ApiToken != "test-token" {
+		t.Fatalf("expected the prompt to be generated again, got err %v", h.m.err)
+	}
+	if !strings.Contains(h.m.toast, "Logged in as replicatetest") {
+		t.Errorf("got toast %q", h.m.toast)
+	}
+	if token, _, err := findToken(&config{}); token != "test-token" || err != nil {
+		t.Errorf("token wasn't saved: %q, %v", token, err)
+	}
+}
+
+func TestTUITokenPromptCancel(t *testing.T) {
+	newFakeReplicate(t)
+	useFakeGenerator(t, false)
+	noToken(t)
+	h := newTUIHarness(t, tuiConfig())
+	h.typeText("login please")
+	h.press("enter")
+	h.typeText("r8_half")
+
+	// Esc gives up on logging in and goes back to the prompt
+	h.press("esc")
+	if h.m.err != nil || !h.m.inputMode || h.m.tokenInput.Value() != "" {
+		t.Fatalf("expected esc to cancel the token prompt, got err %v", h.m.err)
+	}
+}
+
+func TestTUISafety(t *testing.T) {
+	useFakeGenerator(t, false)
+	h := newTUIHarness(t, tuiConfig())
+	h.typeText("an nsfw cat")
+	h.press("enter")
+	if _, ok := h.m.safetyBlocked(); !ok {
+		t.Fatalf("expected the safety filter's error view, got err %v", h.m.err)
+	}
+	if h.m.safety.Tolerance != 6 {
+		t.Errorf("got tolerance %d offered, want 6", h.m.safety.Tolerance)
+	}
+	assertGolden(t, "safety", h.view())
+
+	// The tolerance stays within pro's range
+	h.press("left", "left", "right", "right", "right")
+	if h.m.safety.Tolerance != 6 {
+		t.Errorf("got tolerance %d, want 6", h.m.safety.Tolerance)
+	}
+	h.press("left")
+	h.press("enter")
+	if _, ok := h.m.safetyBlocked(); !ok || h.m.jobs[1].config.safety().Tolerance != 5 {
+		t.Fatalf("expected to be blocked again with tolerance 5, got err %v", h.m.err)
+	}
+
+	h.press("right", "enter")
+	if h.m.err != nil || string(h.m.imageData) != "image of an nsfw cat" {
+		t.Fatalf("expected the retry to get through, got err %v", h.m.err)
+	}
+	if h.m.config.safety().Tolerance != 6 {
+		t.Error("later prompts don't keep the new tolerance")
+	}
+
+	// Or the prompt can be edited
+	h = newTUIHarness(t, tuiConfig())
+	h.typeText("an nsfw dog")
+	h.press("enter")
+	h.press("n")
+	if h.m.err != nil || !h.m.inputMode || h.m.textInput.Value() != "an nsfw dog" {
+		t.Fatalf("expected to edit the prompt, got err %v input %q", h.m.err, h.m.textInput.Value())
+	}
+}
+
+func TestTUISafetyShowBlank(t *testing.T) {
+	useFakeGenerator(t, false)
+	h := newTUIHarness(t, tuiConfig())
+	h.typeText("a black square")
+	h.press("enter")
+	if _, ok := h.m.safetyBlocked(); !ok || !strings.Contains(h.view(), "Y: Show anyway") {
+		t.Fatalf("expected to be offered the blank image, got err %v", h.m.err)
+	}
+	h.press("y")
+	if h.m.err != nil || string(h.m.imageData) != "image of a black square" || h.m.jobs[0].status != jobSucceeded {
+		t.Errorf("expected the blank image to be shown, got err %v", h.m.err)
+	}
+}
+
+func TestTUIResize(t *testing.T) {
+	useFakeGenerator(t, false)
+	h := newTUIHarness(t, tuiConfig())
+	h.typeText("a cat")
+	h.press("enter")
+	h.m.needsImageClear = false
+
+	h.send(tea.WindowSizeMsg{Width: 80, Height: 24})
+	if h.m.width != 80 || h.m.height != 24 || !h.m.needsImageClear {
+		t.Errorf("got %dx%d, needsImageClear=%v", h.m.width, h.m.height, h.m.needsImageClear)
+	}
+}
+
+func TestTUIQueue(t *testing.T) {
+	gen := useFakeGenerator(t, true)
+	h := newTUIHarness(t, tuiConfig())
+
+	for i, prompt := range []string{"one", "two", "three"} {
+		if i > 0 {
+			h.press("n") // back to the prompt input from the loading view
+		}
+		h.typeText(prompt)
+		h.press("enter")
+	}
+	var statuses []string
+	for _, j := range h.m.jobs {
+		statuses = append(statuses, j.status)
+	}
+	if got := strings.Join(statuses, ","); got != "processing,processing,queued" {
+		t.Errorf("got statuses %s with a concurrency of 2", got)
+	}
+
+	h.press("ctrl+l")
+	if !h.m.viewingQueue {
+		t.Fatal("expected the queue")
+	}
+	assertGolden(t, "queue", h.view())
+
+	gen.release()
+	h.settle()
+	for _, j := range h.m.jobs {
+		if j.status != jobSucceeded {
+			t.Errorf("job #%d: got status %s", j.id, j.status)
+		}
+	}
+
+	// Open the first job's image
+	h.press("up", "up", "enter")
+	if h.m.viewingQueue || string(h.m.imageData) != "image of one" {
+		t.Errorf("expected the first image, got %q", h.m.imageData)
+	}
+}
+
+func TestTUIQueueToastHint(t *testing.T) {
+	keys, err := newKeyMap(map[string][]string{"queue": {"ctrl+j"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := useFakeGenerator(t, true)
+	c := tuiConfig()
+	c.Keys = keys
+	h := newTUIHarness(t, c)
+
+	// A job finishing in the background points at the remapped queue key
+	h.typeText("one")
+	h.press("enter", "n")
+	gen.release()
+	h.settle()
+	if !strings.Contains(h.m.toast, "Job #1 finished (Ctrl+J: Queue)") {
+		t.Errorf("got toast %q", h.m.toast)
+	}
+}
+
+func TestTUIQueueWidePrompt(t *testing.T) {
+	useFakeGenerator(t, false)
+	h := newTUIHarness(t, tuiConfig())
+	prompt := strings.Repeat("猫", 30)
+	h.typeText(prompt)
+	h.press("enter", "ctrl+l")
+	view := h.view()
+	if !h.m.viewingQueue || !strings.Contains(view, strings.Repeat("猫", 10)) || strings.Contains(view, prompt) {
+		t.Errorf("expected the wide prompt to be cut to fit:\n%s", view)
+	}
+}
+
+func TestTUIStylePicker(t *testing.T) {
+	h := newTUIHarness(t, tuiConfig())
+	h.press("ctrl+t")
+	if !h.m.pickingStyle {
+		t.Fatal("expected the style picker")
+	}
+	h.press("down", "enter")
+	if h.m.pickingStyle || styleName(h.m.config.Style) != builtinStyles[0].Name {
+		t.Errorf("got style %q", styleName(h.m.config.Style))
+	}
+	if !h.m.textInput.Focused() {
+		t.Error("prompt input lost focus")
+	}
+}
+
+func TestTUIRawAndImagePrompt(t *testing.T) {
+	useFakeGenerator(t, false)
+	c := tuiConfig()
+	c.ImagePrompt = "mood.png"
+	h := newTUIHarness(t, c)
+	if !strings.Contains(h.view(), "Image prompt: mood.png") {
+		t.Fatalf("image prompt isn't shown:\n%s", h.view())
+	}
+
+	h.press("ctrl+r", "ctrl+g")
+	if !h.m.config.Raw || h.m.config.ImagePrompt != "" || c.Raw {
+		t.Fatalf("got raw=%v image prompt=%q", h.m.config.Raw, h.m.config.ImagePrompt)
+	}
+	if v := h.view(); !strings.Contains(v, "📷 Raw") || strings.Contains(v, "Image prompt:") {
+		t.Errorf("toggles aren't shown:\n%s", v)
+	}
+
+	// Prompts keep the toggles they were submitted with
+	h.typeText("a cat")
+	h.press("enter")
+	h.press("n")
+	h.press("ctrl+g", "ctrl+r")
+	if j := h.m.jobs[0]; !j.config.Raw || j.config.ImagePrompt != "" {
+		t.Errorf("job got raw=%v image prompt=%q", j.config.Raw, j.config.ImagePrompt)
+	}
+	if h.m.config.Raw || h.m.config.ImagePrompt != "mood.png" {
+		t.Errorf("got raw=%v image prompt=%q", h.m.config.Raw, h.m.config.ImagePrompt)
+	}
+}
+
+func TestTUILoraPicker(t *testing.T) {
+	h := newTUIHarness(t, tuiConfig())
+	h.press("ctrl+o")
+	if h.m.pickingLora || !strings.Contains(h.m.toast, "No LoRAs") {
+		t.Fatalf("expected a toast without LoRAs, got %q", h.m.toast)
+	}
+
+	c := tuiConfig()
+	c.FluxModel = "dev"
+	c.LoraLibrary = []loraPreset{
+		{Name: "brand", Description: "Our house style", Weights: "acme/brand-style", Scale: 0.8, Trigger: "BRNDSTYLE"},
+		{Name: "grain", Description: "Film grain", Weights: "huggingface.co/alice/film-grain"},
+	}
+	c.Loras = []loraPreset{{Weights: "https://example.com/sketch.safetensors"}}
+	h = newTUIHarness(t, c)
+	h.press("ctrl+o")
+	if !h.m.pickingLora {
+		t.Fatal("expected the LoRA picker")
+	}
+	h.press("enter", "down", "down", "enter")
+	assertGolden(t, "lora-picker", h.view())
+
+	h.press("esc")
+	if h.m.pickingLora || !h.m.textInput.Focused() {
+		t.Fatal("expected the picker to close back to the prompt")
+	}
+	if got := h.m.optionsSummary(); !strings.Contains(got, "LoRAs: brand") || strings.Contains(got, "sketch") {
+		t.Errorf("got %q", got)
+	}
+	if len(c.Loras) != 1 {
+		t.Error("picking LoRAs changed the config queued prompts were submitted with")
+	}
+}
+
+func TestTUIKeys(t *testing.T) {
+	h := newTUIHarness(t, tuiConfig())
+
+	// Keys that type characters go to the prompt
+	h.typeText("q? n")
+	if h.quit || h.m.showingHelp || h.m.textInput.Value() != "q? n" {
+		t.Fatalf("got input %q, quit=%v, help=%v", h.m.textInput.Value(), h.quit, h.m.showingHelp)
+	}
+
+	h.press("f1")
+	if !h.m.showingHelp {
+		t.Fatal("expected the help")
+	}
+	assertGolden(t, "help", h.view())
+	h.press("esc")
+	if h.m.showingHelp || !h.m.textInput.Focused() {
+		t.Fatal("expected the help to close back to the prompt")
+	}
+
+	// The help lists the bindings of the screen it's opened on
+	useFakeGenerator(t, false)
+	h.press("enter")
+	h.press("?")
+	if screen, _ := h.m.helpScreen(); !h.m.showingHelp || screen != "Result" {
+		t.Fatalf("expected the result help, got %q", screen)
+	}
+	h.press("?")
+	h.press("q")
+	if !h.quit {
+		t.Error("q didn't quit on the result screen")
+	}
+}
+
+func TestTUIRecoveryBehindHelp(t *testing.T) {
+	h := newTUIHarness(t, tuiConfig())
+	h.press("f1")
+
+	// The recovery prompt shows up while the help is open
+	h.send(pendingMsg{{entry: journalEntry{PredictionID: "p1", Prompt: "a cat", Model: "schnell"}}})
+	if !strings.Contains(h.view(), "Keys") {
+		t.Fatal("expected the help to stay on top")
+	}
+	h.press("esc")
+	if h.m.showingHelp || len(h.m.recovery) != 1 || !strings.Contains(h.view(), "Recover Images") {
+		t.Fatalf("expected the help to close to the recovery prompt, got %s", h.view())
+	}
+	h.press("esc")
+	if len(h.m.recovery) != 0 || !h.m.textInput.Focused() {
+		t.Error("expected esc to put off recovering")
+	}
+}
+
+func TestTUIRecoveryWidePrompt(t *testing.T) {
+	h := newTUIHarness(t, tuiConfig())
+	prompt := strings.Repeat("🐱", 40)
+	h.send(pendingMsg{{entry: journalEntry{PredictionID: "p1", Prompt: prompt, Model: "schnell"}}})
+	view := h.view()
+	if !strings.Contains(view, "Recover Images") || !strings.Contains(view, "…") || strings.Contains(view, prompt) {
+		t.Errorf("expected the wide prompt to be cut to fit:\n%s", view)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, tt := range []struct {
+		text  string
+		width int
+		want  string
+	}{
+		{"a cat", 10, "a cat"},
+		{"a cat in a hat", 6, "a cat…"},
+		{"猫猫猫猫", 5, "猫猫…"},
+		{"猫猫", 4, "猫猫"},
+		{"a cat", -3, ""},
+	} {
+		got := truncate(tt.text, tt.width)
+		if got != tt.want || ansi.StringWidth(got) > max(0, tt.width) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestTUIRemapKeys(t *testing.T) {
+	if _, err := newKeyMap(map[string][]string{"explode": {"x"}}); err == nil {
+		t.Error("expected an unknown binding to fail")
+	}
+
+	keys, err := newKeyMap(map[string][]string{"quit": {"ctrl+q"}, "copy_prompt": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	useFakeGenerator(t, false)
+	c := tuiConfig()
+	c.Keys = keys
+	c.Prompt = "a cat"
+	h := newTUIHarness(t, c)
+
+	h.press("q")
+	if h.quit {
+		t.Fatal("q still quits")
+	}
+	if hint := h.view(); !strings.Contains(hint, "Ctrl+Q: Quit") || strings.Contains(hint, "Copy prompt") {
+		t.Errorf("hint doesn't show the remapped keys: %s", hint)
+	}
+	h.press("ctrl+q")
+	if !h.quit {
+		t.Error("ctrl+q didn't quit")
+	}
+}
+
+func TestTUIRemapReviewKeys(t *testing.T) {
+	keys, err := newKeyMap(map[string][]string{"quit": {"ctrl+q"}, "edit": {"x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := tuiConfig()
+	c.Keys = keys
+	h := newTUIHarness(t, c)
+	h.m, _ = h.m.startEnhancing("a cat")
+	h.send(enhancedMsg{original: "a cat", enhanced: "a fluffy cat"})
+
+	h.press("q", "e")
+	if h.quit || h.m.editingEnhanced || !h.m.reviewing {
+		t.Fatal("q and e still work on the review")
+	}
+	if hint := h.view(); !strings.Contains(hint, "X: Edit") {
+		t.Errorf("hint doesn't show the remapped keys: %s", hint)
+	}
+	h.press("f1")
+	if screen, _ := h.m.helpScreen(); !h.m.showingHelp || screen != "Enhanced prompt" {
+		t.Fatalf("expected the review's help, got %q", screen)
+	}
+	h.press("esc", "x")
+	h.typeText(" q")
+	if !h.m.editingEnhanced || h.quit || h.m.enhanced.Value() != "a fluffy cat q" {
+		t.Fatalf("got %q while editing", h.m.enhanced.Value())
+	}
+	h.press("esc", "r")
+	if h.m.reviewing || h.m.textInput.Value() != "a cat" {
+		t.Errorf("expected r to reject back to %q, got %q", "a cat", h.m.textInput.Value())
+	}
+	h.press("ctrl+q")
+	if !h.quit {
+		t.Error("ctrl+q didn't quit")
+	}
+}
+
+func TestThemes(t *testing.T) {
+	t.Cleanup(func() { applyTheme(builtinThemes[0]) })
+	themes := themeLibrary([]theme{
+		{Name: "solarized", Base: "light", Primary: "#268BD2"},
+		{Name: "broken", Accent: "teal"},
+	})
+
+	th, err := findTheme(themes, "solarized")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th.Primary != "#268BD2" || th.Text != builtinThemes[1].Text {
+		t.Errorf("unset colors weren't filled in from the base theme: %+v", th)
+	}
+	if _, err := findTheme(themes, "broken"); err == nil || !strings.Contains(err.Error(), "accent") {
+		t.Errorf("got error %v for an invalid color", err)
+	}
+	if _, err := findTheme(themes, "neon"); err == nil {
+		t.Error("expected an unknown theme to fail")
+	}
+
+	useFakeGenerator(t, false)
+	c := tuiConfig()
+	c.Prompt = "a cat"
+	c.Theme = th
+	useTheme(c)
+	h := newTUIHarness(t, c)
+	// Regenerate is selected, on the light theme's warning color
+	if controls := h.m.View(); !strings.Contains(controls, "48;2;180;83;9") {
+		t.Errorf("controls aren't rendered with the theme: %q", controls)
+	}
+
+	// NO_COLOR wins over the theme, the selected button is reversed instead
+	t.Setenv("NO_COLOR", "1")
+	useTheme(c)
+	controls := h.m.View()
+	if strings.Contains(controls, "38;2;") || strings.Contains(controls, "48;2;") || !strings.Contains(controls, "\x1b[7m") {
+		t.Errorf("controls have colors with NO_COLOR: %q", controls)
+	}
+}
@@ -1,6 +1,10 @@
 package cmd
 
-import "time"
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
 
 type Input struct {
 	Seed     int    `json:"seed,omitempty"`     // Random seed. Set for reproducible generation
@@ -14,15 +18,25 @@ type Input struct {
 	// interpretation. Setting this value low will ensure strong prompt following with more consistent outputs, setting it higher
 	// will produce more dynamic or varied outputs.
 	NumOutputs    int    `json:"num_outputs,omitempty"`    // Number of outputs to generate
-	AspectRatio   string `json:"aspect_ratio,omitempty"`   // Aspect ratio for the generated image
+	AspectRatio   string `json:"aspect_ratio,omitempty"`   // Aspect ratio for the generated image, custom for Width and Height
+	Width         int    `json:"width,omitempty"`          // Width of the image when the aspect ratio is custom
+	Height        int    `json:"height,omitempty"`         // Height of the image when the aspect ratio is custom
+	Megapixels    string `json:"megapixels,omitempty"`     // Approximate number of megapixels of the image
 	OutputFormat  string `json:"output_format,omitempty"`  // Format of the output images
 	OutputQuality int    `json:"output_quality,omitempty"` // Quality when saving the output images,
 	// from 0 to 100. 100 is best quality, 0 is lowest quality. Not relevant for .png outputs
 	PromptStrength float32 `json:"prompt_strength,omitempty"` // Prompt strength when using img2img.
 	// 1.0 corresponds to full destruction of information in image
-	NumInferenceSteps    int  `json:"num_inference_steps,omitempty"`    // Number of denoising steps. Recommended range is 28-50
-	DisableSafetyChecker bool `json:"disable_safety_checker,omitempty"` // Disable safety checker for generated images.
-	SafetyTolerance      int  `json:"safety_tolerance,omitempty"`       // Safety tolerance, 1 is most strict and 5 is most permissive
+	NumInferenceSteps    int     `json:"num_inference_steps,omitempty"`    // Number of denoising steps. Recommended range is 28-50
+	DisableSafetyChecker bool    `json:"disable_safety_checker,omitempty"` // Disable safety checker for generated images.
+	SafetyTolerance      int     `json:"safety_tolerance,omitempty"`       // Safety tolerance, 1 is most strict and 5 is most permissive
+	Raw                  bool    `json:"raw,omitempty"`                    // Generate less processed, more natural-looking images
+	ImagePrompt          string  `json:"image_prompt,omitempty"`           // Image to guide the style and composition with, a URL or data URI
+	ImagePromptStrength  float64 `json:"image_prompt_strength,omitempty"`  // Blend between the prompt and the image prompt, 0 to 1
+	LoraWeights          string  `json:"lora_weights,omitempty"`           // LoRA to load, a Replicate model, Hugging Face ID or .safetensors URL
+	LoraScale            float64 `json:"lora_scale,omitempty"`             // How strongly the LoRA is applied
+	ExtraLora            string  `json:"extra_lora,omitempty"`             // Second LoRA to load
+	ExtraLoraScale       float64 `json:"extra_lora_scale,omitempty"`       // How strongly the second LoRA is applied
 }
 
 type Response struct {
@@ -31,6 +45,9 @@ type Response struct {
 	Version string `json:"version"`
 	Input   struct {
 		AspectRatio          string `json:"aspect_ratio"`
+		Width                int    `json:"width"`
+		Height               int    `json:"height"`
+		Megapixels           string `json:"megapixels"`
 		DisableSafetyChecker bool   `json:"disable_safety_checker"`
 		NumOutputs           int    `json:"num_outputs"`
 		OutputFormat         string `json:"output_format"`
@@ -55,3 +72,44 @@ type Response struct {
 		PredictTime float64 `json:"predict_time"`
 	} `json:"metrics"`
 }
+
+// predictionList is a page of predictions
+type predictionList struct {
+	Next     string     `json:"next"`
+	Previous string     `json:"previous"`
+	Results  []Response `json:"results"`
+}
+
+// done returns whether the prediction has finished running
+func (r Response) done() bool {
+	return r.Status == "succeeded" || r.Status == "failed" || r.Status == "canceled"
+}
+
+var seedRE = regexp.MustCompile(`(?i)using seed:\s*(\d+)`)
+
+// seed returns the seed used for the prediction, falling back to the one
+// reported in the logs when a random seed was chosen by the model
+func (r Response) seed() int {
+	if r.Input.Seed != 0 {
+		return r.Input.Seed
+	}
+	if m := seedRE.FindStringSubmatch(r.Logs); m != nil {
+		if seed, err := strconv.Atoi(m[1]); err == nil {
+			return seed
+		}
+	}
+	return 0
+}
+
+// generation holds a generated image and the details of the prediction that produced it
+type generation struct {
+	Image        []byte
+	PredictionID string
+	Prompt       string // Prompt as entered, before any style was applied
+	Style        string // Name of the style applied to the prompt
+	Model        string
+	Seed         int
+	AspectRatio  string
+	Format       string
+	CreatedAt    time.Time
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/log"
+)
+
+var (
+	// raw mode and image prompt flags
+	rawMode             bool
+	imagePrompt         string
+	imagePromptStrength float64
+)
+
+// largeImagePrompt is the size over which local image prompts should rather be URLs
+const largeImagePrompt = 1 << 20
+
+// guided sets the raw and image prompt inputs of the prediction, returning an
+// error if the model doesn't take the ones the config asks for
+func (s *modelSpec) guided(c *config, input *Input) error {
+	invalid := func(format string, args ...any) error {
+		return &generationError{Kind: kindValidation, Err: fmt.Errorf(format, args...)}
+	}
+	if c.Raw {
+		if !s.Raw {
+			return invalid("%s has no raw mode, use pro instead", s.Name)
+		}
+		input.Raw = true
+	}
+	if c.ImagePrompt == "" {
+		return nil
+	}
+	if !s.ImagePrompt {
+		return invalid("%s doesn't take an image prompt, use pro or pro-1.1 instead", s.Name)
+	}
+	if c.ImagePromptStrength < 0 || c.ImagePromptStrength > 1 {
+		return invalid("invalid image prompt strength %v (must be between 0 and 1)", c.ImagePromptStrength)
+	}
+	uri, err := imagePromptURI(c.ImagePrompt)
+	if err != nil {
+		return invalid("%w", err)
+	}
+	input.ImagePrompt = uri
+	if s.ImagePromptStrength {
+		input.ImagePromptStrength = c.ImagePromptStrength
+	}
+	return nil
+}
+
+// imagePromptURI returns the URL Replicate fetches the image prompt from,
+// local files are sent inline as data URIs
+func imagePromptURI(source string) (string, error) {
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "data:") {
+		return source, nil
+	}
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image prompt: %w", err)
+	}
+	if len(data) > largeImagePrompt {
+		log.Warn("Image prompt is large, a URL uploads faster", "path", source, "size", len(data))
+	}
+	return dataURI(data)
+}
+
+// dataURI encodes an image as a data URI
+func dataURI(data []byte) (string, error) {
+	mime := http.DetectContentType(data)
+	if !strings.HasPrefix(mime, "image/") {
+		return "", fmt.Errorf("image prompt is not an image (%s)", mime)
+	}
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// imagePromptName describes where the image prompt comes from
+func imagePromptName(source string) string {
+	switch {
+	case strings.HasPrefix(source, "data:"):
+		return "current image"
+	case strings.HasPrefix(source, "https://"), strings.HasPrefix(source, "http://"):
+		return source
+	}
+	return filepath.Base(source)
+}
+
+// toggleRaw turns raw mode on or off for the next prompts
+func (m newModel) toggleRaw() (newModel, tea.Cmd) {
+	c := *m.config
+	c.Raw = !c.Raw
+	m.config = &c
+	if spec, err := findModel(c.FluxModel); c.Raw && err == nil && !spec.Raw {
+		return m, m.showToast(fmt.Sprintf("⚠️ Raw mode on, but %s has no raw mode", c.FluxModel))
+	}
+	if c.Raw {
+		return m, m.showToast("📷 Raw mode on")
+	}
+	return m, m.showToast("📷 Raw mode off")
+}
+
+// toggleImagePrompt turns the image prompt on or off for the next prompts, the
+// image shown is used when --image-prompt wasn't set
+func (m newModel) toggleImagePrompt() (newModel, tea.Cmd) {
+	c := *m.config
+	if c.ImagePrompt != "" {
+		m.imagePrompt = c.ImagePrompt
+		c.ImagePrompt = ""
+		m.config = &c
+		return m, m.showToast("🖼 Image prompt off")
+	}
+	source := m.imagePrompt
+	if source == "" && len(m.imageData) > 0 {
+		uri, err := dataURI(m.imageData)
+		if err != nil {
+			return m, m.showToast(fmt.Sprintf("⚠️ %v", err))
+		}
+		source = uri
+	}
+	if source == "" {
+		return m, m.showToast("⚠️ No image prompt, set --image-prompt or generate an image first")
+	}
+	c.ImagePrompt = source
+	m.config = &c
+	if spec, err := findModel(c.FluxModel); err == nil && !spec.ImagePrompt {
+		return m, m.showToast(fmt.Sprintf("⚠️ Image prompt on, but %s doesn't take one", c.FluxModel))
+	}
+	return m, m.showToast("🖼 Image prompt: " + imagePromptName(source))
+}
+
+// optionsSummary describes the style and toggles the next prompts are generated with
+func (m newModel) optionsSummary() string {
+	parts := []string{"🎨 Style: " + cmp.Or(styleName(m.config.Style), "none")}
+	if m.config.Raw {
+		parts = append(parts, "📷 Raw")
+	}
+	if m.config.ImagePrompt != "" {
+		parts = append(parts, "🖼 Image prompt: "+imagePromptName(m.config.ImagePrompt))
+	}
+	if len(m.config.Loras) > 0 {
+		labels := make([]string, 0, len(m.config.Loras))
+		for _, l := range m.config.Loras {
+			labels = append(labels, l.label())
+		}
+		parts = append(parts, "🧩 LoRAs: "+strings.Join(labels, ", "))
+	}
+	return strings.Join(parts, " • ")
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/v2/key"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+const (
+	maxZoom      = 16
+	zoomStep     = 1.5
+	panStep      = 0.25 // fraction of the viewport moved by a key press
+	minimapWidth = 20
+	minimapMin   = 60 // narrower terminals leave the minimap out
+)
+
+// zoomState is the part of the full resolution image shown by the zoom viewer
+type zoomState struct {
+	img          image.Image // decoded imageData
+	level        float64     // magnification, 1 fits the whole image
+	cx, cy       float64     // center of the viewport in image pixels
+	dragging     bool
+	dragX, dragY int // cell the mouse was last dragged to
+}
+
+// viewport returns the part of the image that's shown
+func (z zoomState) viewport() image.Rectangle {
+	b := z.img.Bounds()
+	w := max(1, int(float64(b.Dx())/z.level))
+	h := max(1, int(float64(b.Dy())/z.level))
+	x := min(max(b.Min.X, int(z.cx)-w/2), b.Max.X-w)
+	y := min(max(b.Min.Y, int(z.cy)-h/2), b.Max.Y-h)
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// zoomBy changes the magnification by the factor, keeping the center
+func (z zoomState) zoomBy(factor float64) zoomState {
+	z.level = min(max(1, z.level*factor), maxZoom)
+	return z.clamped()
+}
+
+// pan moves the viewport by the fraction of its size
+func (z zoomState) pan(dx, dy float64) zoomState {
+	v := z.viewport()
+	z.cx += dx * float64(v.Dx())
+	z.cy += dy * float64(v.Dy())
+	return z.clamped()
+}
+
+// clamped keeps the viewport inside the image
+func (z zoomState) clamped() zoomState {
+	v := z.viewport()
+	z.cx = float64(v.Min.X+v.Max.X) / 2
+	z.cy = float64(v.Min.Y+v.Max.Y) / 2
+	return z
+}
+
+// openZoom decodes the full resolution image and shows all of it in the zoom viewer
+func (m newModel) openZoom() (newModel, tea.Cmd) {
+	img, _, err := image.Decode(bytes.NewReader(m.imageData))
+	if err != nil {
+		return m, m.showToast(fmt.Sprintf("⚠️ Failed to decode image: %v", err))
+	}
+	b := img.Bounds()
+	m.zoom = zoomState{
+		img:   img,
+		level: 1,
+		cx:    float64(b.Min.X+b.Max.X) / 2,
+		cy:    float64(b.Min.Y+b.Max.Y) / 2,
+	}
+	m.zooming = true
+	m.needsImageClear = true
+	return m, nil
+}
+
+// closeZoom goes back to the image view
+func (m newModel) closeZoom() (newModel, tea.Cmd) {
+	m.zooming = false
+	m.zoom = zoomState{}
+	m.needsImageClear = true
+	return m, nil
+}
+
+// updateZoom handles key presses while the zoom viewer is open
+func (m newModel) updateZoom(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	k := m.keys
+	switch {
+	case key.Matches(msg, k.Quit):
+		return m, tea.Quit
+	case key.Matches(msg, k.Help):
+		return m.openHelp()
+	case key.Matches(msg, k.Back, k.Zoom):
+		return m.closeZoom()
+	case key.Matches(msg, k.ZoomIn):
+		m.zoom = m.zoom.zoomBy(zoomStep)
+	case key.Matches(msg, k.ZoomOut):
+		m.zoom = m.zoom.zoomBy(1 / zoomStep)
+	case key.Matches(msg, k.ZoomReset):
+		m.zoom.level = 1
+		m.zoom = m.zoom.clamped()
+	case key.Matches(msg, k.PanLeft):
+		m.zoom = m.zoom.pan(-panStep, 0)
+	case key.Matches(msg, k.PanRight):
+		m.zoom = m.zoom.pan(panStep, 0)
+	case key.Matches(msg, k.PanUp):
+		m.zoom = m.zoom.pan(0, -panStep)
+	case key.Matches(msg, k.PanDown):
+		m.zoom = m.zoom.pan(0, panStep)
+	default:
+		return m, nil
+	}
+	m.needsImageClear = true
+	return m, nil
+}
+
+// updateZoomMouse pans the viewport by dragging the image and zooms with the wheel
+func (m newModel) updateZoomMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	mouse := msg.Mouse()
+	l := m.layout()
+	switch msg.(type) {
+	case tea.MouseClickMsg:
+		if mouse.Button == tea.MouseLeft && l.Image.contains(mouse.X, mouse.Y) {
+			m.zoom.dragging = true
+			m.zoom.dragX, m.zoom.dragY = mouse.X, mouse.Y
+		}
+		return m, nil
+	case tea.MouseMotionMsg:
+		if !m.zoom.dragging || l.Image.W == 0 || l.Image.H == 0 {
+			return m, nil
+		}
+		// The image follows the mouse, so the viewport moves the other way
+		dx := float64(m.zoom.dragX-mouse.X) / float64(l.Image.W)
+		dy := float64(m.zoom.dragY-mouse.Y) / float64(l.Image.H)
+		m.zoom = m.zoom.pan(dx, dy)
+		m.zoom.dragX, m.zoom.dragY = mouse.X, mouse.Y
+	case tea.MouseReleaseMsg:
+		m.zoom.dragging = false
+		return m, nil
+	case tea.MouseWheelMsg:
+		switch mouse.Button {
+		case tea.MouseWheelUp:
+			m.zoom = m.zoom.zoomBy(zoomStep)
+		case tea.MouseWheelDown:
+			m.zoom = m.zoom.zoomBy(1 / zoomStep)
+		default:
+			return m, nil
+		}
+	}
+	m.needsImageClear = true
+	return m, nil
+}
+
+// crop copies the part of the image so it's drawn on its own
+func crop(img image.Image, r image.Rectangle) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
+
+// minimapView returns the lines of the minimap, the whole image with the part shown highlighted
+func (m newModel) minimapView(r rect) []string {
+	b := m.zoom.img.Bounds()
+	v := m.zoom.viewport()
+	w := min(minimapWidth, r.W)
+	// Cells are about twice as tall as they're wide
+	h := min(max(1, w*b.Dy()/b.Dx()/2), max(1, r.H-5))
+
+	outside := lipgloss.NewStyle().Foreground(mutedColor)
+	inside := lipgloss.NewStyle().Foreground(accentColor)
+	lines := []string{lipgloss.NewStyle().Bold(true).Foreground(primaryColor).Render("🧭 Minimap"), ""}
+	for y := range h {
+		var row strings.Builder
+		for x := range w {
+			cell := image.Rect(
+				b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h,
+				b.Min.X+(x+1)*b.Dx()/w, b.Min.Y+(y+1)*b.Dy()/h,
+			)
+			if cell.Overlaps(v) {
+				row.WriteString(inside.Render("█"))
+			} else {
+				row.WriteString(outside.Render("░"))
+			}
+		}
+		lines = append(lines, row.String())
+	}
+
+	label := lipgloss.NewStyle().Foreground(mutedColor)
+	value := lipgloss.NewStyle().Foreground(textColor)
+	return append(lines, "",
+		label.Render("Zoom  ")+value.Render(fmt.Sprintf("%.1fx", m.zoom.level)),
+		label.Render("View  ")+value.Render(fmt.Sprintf("%dx%d+%d+%d", v.Dx(), v.Dy(), v.Min.X, v.Min.Y)),
+	)
+}
@@ -0,0 +1,433 @@
+// Package replicatetest provides a fake Replicate API server for tests.
+//
+// The server emulates the predictions lifecycle: a created prediction starts
+// out "starting", moves to "processing" on the first poll and finishes on a
+// later poll as scripted by [Server.Script], with output URLs served by the
+// server itself (with Range requests and cut off downloads), logs, metrics,
+// cancellation and rate limiting.
+//
+//	srv := replicatetest.NewServer()
+//	defer srv.Close()
+//	os.Setenv("FLUXY_REPLICATE_API", srv.URL+"/v1")
+package replicatetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prediction is a prediction as returned by the Replicate API
+type Prediction struct {
+	ID          string         `json:"id"`
+	Model       string         `json:"model"`
+	Version     string         `json:"version"`
+	Input       map[string]any `json:"input"`
+	Logs        string         `json:"logs"`
+	Output      any            `json:"output"`
+	DataRemoved bool           `json:"data_removed"`
+	Error       any            `json:"error"`
+	Status      string         `json:"status"`
+	CreatedAt   time.Time      `json:"created_at"`
+	StartedAt   *time.Time     `json:"started_at"`
+	CompletedAt *time.Time     `json:"completed_at"`
+	URLs        struct {
+		Cancel string `json:"cancel"`
+		Get    string `json:"get"`
+	} `json:"urls"`
+	Metrics struct {
+		ImageCount  int     `json:"image_count,omitempty"`
+		PredictTime float64 `json:"predict_time,omitempty"`
+	} `json:"metrics"`
+
+	polls  int
+	script Script
+}
+
+// Script decides how a prediction plays out
+type Script struct {
+	Polls  int    // Polls until the prediction finishes (default 2)
+	Status string // Final status: succeeded (default), failed or canceled
+	Error  string // Error of a failed prediction
+	Logs   string // Logs, "Using seed: N" is added for a succeeded prediction
+	Seed   int    // Seed reported in the logs (default 42)
+	Image  []byte // Image served as the output (default a small PNG)
+	// Output overrides the output, by default it's a list with the URL of Image
+	Output any
+	// DataRemoved reports the output as removed, like Replicate does after an hour
+	DataRemoved bool
+	// Invalid rejects the input with a 422 and this description instead of creating a prediction
+	Invalid string
+}
+
+// Server is a fake Replicate API
+type Server struct {
+	*httptest.Server
+
+	// Token is the API token requests must be authorized with, any token is accepted when empty
+	Token string
+	// Script returns how a new prediction plays out, by default it succeeds
+	Script func(model string, input map[string]any) Script
+	// PageSize is the number of predictions per page when listing (default 100)
+	PageSize int
+	// Username is the account the token belongs to (default "replicatetest")
+	Username string
+
+	mu           sync.Mutex
+	predictions  []*Prediction
+	rateLimited  int
+	requests     int
+	cutDownloads int
+	downloads    []string
+}
+
+// NewServer starts a fake Replicate API, the API lives under URL+"/v1"
+func NewServer() *Server {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/models/{owner}/{name}/predictions", s.create)
+	mux.HandleFunc("POST /v1/predictions", s.create)
+	mux.HandleFunc("GET /v1/predictions", s.list)
+	mux.HandleFunc("GET /v1/predictions/{id}", s.get)
+	mux.HandleFunc("POST /v1/predictions/{id}/cancel", s.cancel)
+	mux.HandleFunc("GET /v1/account", s.account)
+	mux.HandleFunc("GET /output/{id}", s.output)
+	s.Server = httptest.NewServer(s.limit(mux))
+	return s
+}
+
+// RateLimit answers the next n API requests with 429 Too Many Requests
+func (s *Server) RateLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimited = n
+}
+
+// CutDownloads cuts off the next n output downloads halfway through, like a dropped connection
+func (s *Server) CutDownloads(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cutDownloads = n
+}
+
+// Downloads returns the Range header of every output download so far, "" when the whole image was asked for
+func (s *Server) Downloads() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.downloads)
+}
+
+// Requests returns the number of API requests the server has received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Predictions returns copies of the predictions created so far, oldest first
+func (s *Server) Predictions() []Prediction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	predictions := make([]Prediction, 0, len(s.predictions))
+	for _, p := range s.predictions {
+		predictions = append(predictions, *p)
+	}
+	return predictions
+}
+
+// Prediction returns a copy of the prediction with the given ID
+func (s *Server) Prediction(id string) (Prediction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := s.find(id); p != nil {
+		return *p, true
+	}
+	return Prediction{}, false
+}
+
+// Add adds an existing prediction, e.g. one that finished while the client wasn't running
+func (s *Server) Add(p Prediction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.ID == "" {
+		p.ID = s.newID()
+	}
+	p.URLs.Get = s.URL + "/v1/predictions/" + p.ID
+	p.URLs.Cancel = p.URLs.Get + "/cancel"
+	s.predictions = append(s.predictions, &p)
+}
+
+// limit counts API requests and rate limits them when asked to
+func (s *Server) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v1/") {
+			s.mu.Lock()
+			s.requests++
+			limited := s.rateLimited > 0
+			if limited {
+				s.rateLimited--
+			}
+			s.mu.Unlock()
+			if limited {
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusTooManyRequests, "Request was throttled. Expected available in 1 second.")
+				return
+			}
+			if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+				writeError(w, http.StatusUnauthorized, "You did not pass a valid authentication token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) account(w http.ResponseWriter, r *http.Request) {
+	username := s.Username
+	if username == "" {
+		username = "replicatetest"
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"type":     "user",
+		"username": username,
+		"name":     username,
+	})
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Version string         `json:"version"`
+		Input   map[string]any `json:"input"`
+	}
+	data, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(data, &body)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if body.Input == nil {
+		writeError(w, http.StatusUnprocessableEntity, "input is required")
+		return
+	}
+
+	model := body.Version
+	if owner := r.PathValue("owner"); owner != "" {
+		model = owner + "/" + r.PathValue("name")
+	}
+	script := Script{}
+	if s.Script != nil {
+		script = s.Script(model, body.Input)
+	}
+	if script.Invalid != "" {
+		writeError(w, http.StatusUnprocessableEntity, script.Invalid)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := &Prediction{
+		ID:        s.newID(),
+		Model:     model,
+		Version:   body.Version,
+		Input:     body.Input,
+		Status:    "starting",
+		CreatedAt: time.Now().UTC(),
+		script:    script,
+	}
+	p.URLs.Get = s.URL + "/v1/predictions/" + p.ID
+	p.URLs.Cancel = p.URLs.Get + "/cancel"
+	s.predictions = append(s.predictions, p)
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.find(r.PathValue("id"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	s.advance(p)
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) cancel(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.find(r.PathValue("id"))
+	if p == nil {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	if p.Status == "starting" || p.Status == "processing" {
+		p.finish("canceled")
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pageSize := s.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	start, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+	var page struct {
+		Next     *string       `json:"next"`
+		Previous *string       `json:"previous"`
+		Results  []*Prediction `json:"results"`
+	}
+	page.Results = []*Prediction{}
+	// newest first
+	for i := len(s.predictions) - 1 - start; i >= 0 && len(page.Results) < pageSize; i-- {
+		page.Results = append(page.Results, s.predictions[i])
+	}
+	if end := start + len(page.Results); end < len(s.predictions) {
+		next := fmt.Sprintf("%s/v1/predictions?cursor=%d", s.URL, end)
+		page.Next = &next
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) output(w http.ResponseWriter, r *http.Request) {
+	// Polls move the prediction along, so everything it's served from is read under the lock
+	s.mu.Lock()
+	p := s.find(r.PathValue("id"))
+	if p == nil || p.Status != "succeeded" || p.DataRemoved {
+		s.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	img := p.script.Image
+	if img == nil {
+		img = defaultImage
+	}
+	s.downloads = append(s.downloads, r.Header.Get("Range"))
+	cut := s.cutDownloads > 0
+	if cut {
+		s.cutDownloads--
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", http.DetectContentType(img))
+	if cut {
+		// Promise the whole image but send half, the client sees an unexpected EOF
+		w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+		w.Write(img[:len(img)/2])
+		return
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(img))
+}
+
+// advance moves the prediction one step through its lifecycle
+func (s *Server) advance(p *Prediction) {
+	if p.Status != "starting" && p.Status != "processing" {
+		return
+	}
+	p.polls++
+	polls := p.script.Polls
+	if polls <= 0 {
+		polls = 2
+	}
+	if p.polls < polls {
+		if p.Status == "starting" {
+			now := time.Now().UTC()
+			p.StartedAt = &now
+			p.Status = "processing"
+		}
+		return
+	}
+
+	status := p.script.Status
+	if status == "" {
+		status = "succeeded"
+	}
+	p.Logs = p.script.Logs
+	switch status {
+	case "succeeded":
+		seed := p.script.Seed
+		if seed == 0 {
+			seed = 42
+		}
+		p.Logs += fmt.Sprintf("Using seed: %d\n", seed)
+		p.Output = p.script.Output
+		if p.Output == nil {
+			p.Output = []any{s.URL + "/output/" + p.ID}
+		}
+		p.DataRemoved = p.script.DataRemoved
+		p.Metrics.ImageCount = 1
+	case "failed":
+		p.Error = p.script.Error
+	}
+	p.finish(status)
+}
+
+func (p *Prediction) finish(status string) {
+	now := time.Now().UTC()
+	if p.StartedAt == nil {
+		p.StartedAt = &now
+	}
+	p.CompletedAt = &now
+	p.Metrics.PredictTime = now.Sub(p.CreatedAt).Seconds()
+	p.Status = status
+}
+
+func (s *Server) find(id string) *Prediction {
+	for _, p := range s.predictions {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *Server) newID() string {
+	return fmt.Sprintf("fake%08d", len(s.predictions)+1)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, map[string]any{
+		"title":  http.StatusText(status),
+		"detail": detail,
+		"status": status,
+	})
+}
+
+// defaultImage is the 8x8 PNG served as the output of succeeded predictions
+var defaultImage = func() []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := range 8 {
+		for x := range 8 {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 32), G: uint8(y * 32), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}()
+
+// Image returns the image served as the output of succeeded predictions by default
+func Image() []byte {
+	return bytes.Clone(defaultImage)
+}
@@ -0,0 +1,227 @@
+package replicatetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func do(t *testing.T, method, url string, body string) (*http.Response, Prediction) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var p Prediction
+	json.NewDecoder(resp.Body).Decode(&p)
+	return resp, p
+}
+
+func TestLifecycle(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Token = "token"
+
+	resp, p := do(t, "POST", srv.URL+"/v1/models/black-forest-labs/flux-dev/predictions", `{"input":{"prompt":"a cat"}}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: got %s", resp.Status)
+	}
+	if p.Status != "starting" || p.Model != "black-forest-labs/flux-dev" || p.Input["prompt"] != "a cat" {
+		t.Fatalf("create: got %+v", p)
+	}
+
+	for _, want := range []string{"processing", "succeeded", "succeeded"} {
+		if _, p = do(t, "GET", p.URLs.Get, ""); p.Status != want {
+			t.Fatalf("poll: got status %q, want %q", p.Status, want)
+		}
+	}
+	if !strings.Contains(p.Logs, "Using seed: 42") || p.Metrics.ImageCount != 1 || p.CompletedAt == nil {
+		t.Errorf("succeeded prediction is missing details: %+v", p)
+	}
+
+	urls, _ := p.Output.([]any)
+	if len(urls) != 1 {
+		t.Fatalf("got output %v", p.Output)
+	}
+	resp, err := http.Get(urls[0].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	img, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(img, Image()) {
+		t.Errorf("output is not the default image")
+	}
+}
+
+func TestFailedAndCanceled(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Script = func(model string, input map[string]any) Script {
+		return Script{Polls: 1, Status: "failed", Error: "NSFW content detected"}
+	}
+
+	_, p := do(t, "POST", srv.URL+"/v1/predictions", `{"version":"abc","input":{}}`)
+	if _, p = do(t, "GET", p.URLs.Get, ""); p.Status != "failed" || p.Error != "NSFW content detected" {
+		t.Errorf("got %+v", p)
+	}
+
+	srv.Script = nil
+	_, p = do(t, "POST", srv.URL+"/v1/predictions", `{"version":"abc","input":{}}`)
+	if _, p = do(t, "POST", p.URLs.Cancel, ""); p.Status != "canceled" {
+		t.Errorf("cancel: got status %q", p.Status)
+	}
+	if _, p = do(t, "GET", p.URLs.Get, ""); p.Status != "canceled" {
+		t.Errorf("poll after cancel: got status %q", p.Status)
+	}
+
+	srv.Script = func(model string, input map[string]any) Script {
+		return Script{Invalid: "aspect_ratio must be one of the following"}
+	}
+	if resp, _ := do(t, "POST", srv.URL+"/v1/predictions", `{"version":"abc","input":{}}`); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("invalid input: got %s", resp.Status)
+	}
+	if n := len(srv.Predictions()); n != 2 {
+		t.Errorf("got %d predictions, the invalid one shouldn't be created", n)
+	}
+}
+
+func TestDownloads(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Script = func(model string, input map[string]any) Script {
+		return Script{Polls: 1}
+	}
+	_, p := do(t, "POST", srv.URL+"/v1/predictions", `{"input":{}}`)
+	_, p = do(t, "GET", p.URLs.Get, "")
+	url := p.Output.([]any)[0].(string)
+
+	srv.CutDownloads(1)
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	half, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil || len(half) != len(Image())/2 {
+		t.Fatalf("expected the download to be cut off halfway, got %d bytes, %v", len(half), err)
+	}
+
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Range", "bytes=10-")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(rest, Image()[10:]) {
+		t.Errorf("got %s with %d bytes for the rest of the image", resp.Status, len(rest))
+	}
+	if got := srv.Downloads(); len(got) != 2 || got[0] != "" || got[1] != "bytes=10-" {
+		t.Errorf("got downloads %q", got)
+	}
+}
+
+func TestConcurrentPollsAndDownloads(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	// Run with -race: downloads read the predictions while polls move them along
+	var wg sync.WaitGroup
+	for range 20 {
+		_, p := do(t, "POST", srv.URL+"/v1/predictions", `{"input":{}}`)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 3 {
+				do(t, "GET", p.URLs.Get, "")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if resp, err := http.Get(srv.URL + "/output/" + p.ID); err == nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, p := range srv.Predictions() {
+		if p.Status != "succeeded" {
+			t.Errorf("got status %q for %s", p.Status, p.ID)
+		}
+	}
+}
+
+func TestRateLimitAndAuth(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.RateLimit(1)
+
+	resp, _ := do(t, "POST", srv.URL+"/v1/predictions", `{"input":{}}`)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("got %s, want 429 with Retry-After", resp.Status)
+	}
+	if resp, _ = do(t, "POST", srv.URL+"/v1/predictions", `{"input":{}}`); resp.StatusCode != http.StatusCreated {
+		t.Errorf("got %s after the rate limit", resp.Status)
+	}
+
+	if resp, _ = do(t, "GET", srv.URL+"/v1/account", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("got %s for the account", resp.Status)
+	}
+
+	srv.Token = "other"
+	if resp, _ = do(t, "GET", srv.URL+"/v1/predictions", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %s with the wrong token", resp.Status)
+	}
+	if resp, _ = do(t, "GET", srv.URL+"/v1/account", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %s for the account with the wrong token", resp.Status)
+	}
+	if n := srv.Requests(); n != 5 {
+		t.Errorf("got %d requests, want 5", n)
+	}
+}
+
+func TestList(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.PageSize = 2
+	for range 3 {
+		srv.Add(Prediction{Status: "succeeded"})
+	}
+
+	var ids []string
+	next := srv.URL + "/v1/predictions"
+	for next != "" {
+		resp, err := http.Get(next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var page struct {
+			Next    string       `json:"next"`
+			Results []Prediction `json:"results"`
+		}
+		json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		for _, p := range page.Results {
+			ids = append(ids, p.ID)
+		}
+		next = page.Next
+	}
+	if got := strings.Join(ids, ","); got != "fake00000003,fake00000002,fake00000001" {
+		t.Errorf("got %s, want newest first", got)
+	}
+}